@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/madwire-media/secrets-cli/engines/mapping"
 	"github.com/madwire-media/secrets-cli/engines/vault"
 	"github.com/madwire-media/secrets-cli/project"
 	"github.com/madwire-media/secrets-cli/util"
@@ -76,20 +77,29 @@ func addSecret(file string, openProject *project.Project) error {
 		return err
 	}
 
-	var host string
+	var address string
 
 	if vaultHostChoice == len(choices)-1 {
 		// Other choice
-		host = util.CliQuestion("Custom Vault host (i.e. example.com:8080)")
+		address = util.CliQuestion("Custom Vault host (i.e. example.com:8080, or http://127.0.0.1:8200 with --allow-http)")
 	} else {
-		host = choices[vaultHostChoice]
+		address = choices[vaultHostChoice]
+
+		if vars.AllowHTTP && !util.CliQuestionYesNoDefault("Use HTTPS?", true) {
+			address = "http://" + address
+		}
+	}
+
+	vaultURL, err := vault.ParseAddress(address)
+	if err != nil {
+		return err
 	}
 
 	// TODO: use Vault /sys/mounts API to list available secrets engines?
 
 	path := util.CliQuestion("Path to secret in Vault (i.e. secrets-engine/path/to/secret)")
 
-	vaultConfig.URL = "https://" + host + "/" + path
+	vaultConfig.URL = vaultURL.String() + "/" + path
 
 	choices = []string{
 		"From data (map a portion of Vault secret as JSON or YAML)",
@@ -132,7 +142,7 @@ func addSecret(file string, openProject *project.Project) error {
 			path = &parsedPath
 		}
 
-		vaultConfig.Mapping.FromData = &vault.FromDataMapping{
+		vaultConfig.Mapping.FromData = &mapping.FromDataMapping{
 			Format: vaultDataFormat,
 			Path:   path,
 		}
@@ -141,7 +151,7 @@ func addSecret(file string, openProject *project.Project) error {
 
 		rawPath := util.CliQuestion("Path to data within Vault secret")
 
-		vaultConfig.Mapping.FromText = &vault.FromTextMapping{
+		vaultConfig.Mapping.FromText = &mapping.FromTextMapping{
 			Path: parsePath(rawPath),
 		}
 	}
@@ -155,9 +165,9 @@ func addSecret(file string, openProject *project.Project) error {
 	openProject.Config.Secrets = append(
 		openProject.Config.Secrets,
 		project.SecretConfig{
-			File:  file,
-			Class: usedClass,
-			Vault: &vaultConfig,
+			File:   file,
+			Class:  usedClass,
+			Engine: &vaultConfig,
 		},
 	)
 
@@ -14,14 +14,14 @@ import (
 )
 
 var configLoginCmd = &cobra.Command{
-	Use:   "login [host]",
+	Use:   "login [host or URL]",
 	Short: "Login to a Vault server",
 	Args:  cobra.MaximumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		var host string
+		var address string
 
 		if len(args) == 1 {
-			host = args[0]
+			address = args[0]
 		} else {
 			if !vars.IsTTY {
 				fmt.Println("Error: must specify host as an argument or use a TTY")
@@ -29,9 +29,18 @@ var configLoginCmd = &cobra.Command{
 				return
 			}
 
-			host = util.CliQuestion("Vault host (domain and port only)")
+			address = util.CliQuestion("Vault host (domain and port, or http:// and the host with --allow-http)")
 		}
 
+		vaultURL, err := vault.ParseAddress(address)
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+			return
+		}
+
+		host := vaultURL.Host
+
 		vaultAuth, err := getLoginAuth(host, cmd.Flags())
 		if err != nil {
 			fmt.Println("Error getting login auth:", err)
@@ -39,7 +48,7 @@ var configLoginCmd = &cobra.Command{
 			return
 		}
 
-		err = vault.TryAuth(host, vaultAuth)
+		err = vault.TryAuth(vaultURL, vaultAuth)
 		if err != nil {
 			fmt.Println("Error logging in to Vault:", err)
 			os.Exit(1)
@@ -104,6 +113,22 @@ func init() {
 	configLoginCmd.Flags().String("secret-id", "", "secret ID for AppRole auth (optional)")
 	configLoginCmd.Flags().Bool("oidc", false, "Use OIDC auth method")
 	configLoginCmd.Flags().String("oidc-mount", "", "OIDC mount path")
+	configLoginCmd.Flags().String("kubernetes-role", "", "role for Kubernetes auth")
+	configLoginCmd.Flags().String("kubernetes-jwt-path", "", "service account JWT path for Kubernetes auth (optional)")
+	configLoginCmd.Flags().String("kubernetes-mount", "", "Kubernetes mount path (optional)")
+	configLoginCmd.Flags().String("jwt-role", "", "role for JWT auth")
+	configLoginCmd.Flags().String("jwt-file", "", "file to read the JWT from for JWT auth")
+	configLoginCmd.Flags().String("jwt-env", "", "environment variable to read the JWT from for JWT auth")
+	configLoginCmd.Flags().String("jwt-mount", "", "JWT mount path (optional)")
+	configLoginCmd.Flags().Bool("cert", false, "Use TLS certificate auth method, with --client-cert and --client-key")
+	configLoginCmd.Flags().String("cert-name", "", "certificate role name for TLS certificate auth (optional)")
+	configLoginCmd.Flags().String("cert-mount", "", "TLS certificate auth mount path (optional)")
+	configLoginCmd.Flags().String("ca-file", "", "CA bundle to verify the Vault server's certificate with")
+	configLoginCmd.Flags().String("client-cert", "", "TLS client certificate file")
+	configLoginCmd.Flags().String("client-key", "", "TLS client key file")
+	configLoginCmd.Flags().String("tls-server-name", "", "server name to verify the Vault server's certificate with")
+	configLoginCmd.Flags().Bool("tls-skip-verify", false, "Don't verify the Vault server's certificate (only for local development)")
+	configLoginCmd.Flags().String("namespace", "", "Vault Enterprise namespace to log in to")
 }
 
 func getLoginAuth(host string, flags *pflag.FlagSet) (*types.VaultAuth, error) {
@@ -114,6 +139,18 @@ func getLoginAuth(host string, flags *pflag.FlagSet) (*types.VaultAuth, error) {
 	secretID, _ := flags.GetString("secret-id")
 	oidc, _ := flags.GetBool("oidc")
 	oidcMount, _ := flags.GetString("oidc-mount")
+	kubernetesRole, _ := flags.GetString("kubernetes-role")
+	kubernetesJWTPath, _ := flags.GetString("kubernetes-jwt-path")
+	kubernetesMount, _ := flags.GetString("kubernetes-mount")
+	jwtRole, _ := flags.GetString("jwt-role")
+	jwtFile, _ := flags.GetString("jwt-file")
+	jwtEnv, _ := flags.GetString("jwt-env")
+	jwtMount, _ := flags.GetString("jwt-mount")
+	cert, _ := flags.GetBool("cert")
+	certName, _ := flags.GetString("cert-name")
+	certMount, _ := flags.GetString("cert-mount")
+	tlsSettings := getLoginTLS(flags)
+	namespace, _ := flags.GetString("namespace")
 
 	var auth types.VaultAuth
 	var err error
@@ -165,13 +202,86 @@ func getLoginAuth(host string, flags *pflag.FlagSet) (*types.VaultAuth, error) {
 		auth.OIDC = &types.VaultAuthOIDC{
 			Mount: oidcMount,
 		}
+	} else if kubernetesRole != "" {
+		auth.Kubernetes = &types.VaultAuthKubernetes{
+			Role:    kubernetesRole,
+			JWTPath: kubernetesJWTPath,
+			Mount:   kubernetesMount,
+		}
+	} else if kubernetesJWTPath != "" || kubernetesMount != "" {
+		return nil, errors.New("kubernetes-jwt-path or kubernetes-mount is defined but no kubernetes-role is defined")
+	} else if jwtRole != "" {
+		if jwtFile == "" && jwtEnv == "" {
+			return nil, errors.New("must specify --jwt-file or --jwt-env")
+		} else if jwtFile != "" && jwtEnv != "" {
+			return nil, errors.New("only one of --jwt-file or --jwt-env can be specified")
+		}
+
+		auth.JWT = &types.VaultAuthJWT{
+			Role:    jwtRole,
+			JWTFile: jwtFile,
+			JWTEnv:  jwtEnv,
+			Mount:   jwtMount,
+		}
+	} else if jwtFile != "" || jwtEnv != "" || jwtMount != "" {
+		return nil, errors.New("jwt-file, jwt-env, or jwt-mount is defined but no jwt-role is defined")
+	} else if cert {
+		if tlsSettings == nil || tlsSettings.ClientCert == "" || tlsSettings.ClientKey == "" {
+			return nil, errors.New("must specify --client-cert and --client-key for TLS certificate auth")
+		}
+
+		auth.Cert = &types.VaultAuthCert{
+			Name:  certName,
+			Mount: certMount,
+		}
+	} else if certName != "" || certMount != "" {
+		return nil, errors.New("cert-name or cert-mount is defined but cert is not enabled")
 	} else {
 		if !vars.IsTTY {
 			return nil, errors.New("must specify credentials as arguments or use a TTY")
 		}
 
-		return vault.GetLoginAuthTTY()
+		ttyAuth, err := vault.GetLoginAuthTTY()
+		if err != nil {
+			return nil, err
+		}
+
+		if namespace != "" {
+			ttyAuth.Namespace = namespace
+		}
+
+		if tlsSettings != nil {
+			if ttyAuth.TLS != nil {
+				tlsSettings.ClientCert = ttyAuth.TLS.ClientCert
+				tlsSettings.ClientKey = ttyAuth.TLS.ClientKey
+			}
+
+			ttyAuth.TLS = tlsSettings
+		}
+
+		return ttyAuth, nil
 	}
 
+	auth.Namespace = namespace
+	auth.TLS = tlsSettings
+
 	return &auth, nil
 }
+
+// getLoginTLS gets the TLS settings from the login flags, or nil if there
+// aren't any
+func getLoginTLS(flags *pflag.FlagSet) *types.VaultAuthTLS {
+	var settings types.VaultAuthTLS
+
+	settings.CAFile, _ = flags.GetString("ca-file")
+	settings.ClientCert, _ = flags.GetString("client-cert")
+	settings.ClientKey, _ = flags.GetString("client-key")
+	settings.ServerName, _ = flags.GetString("tls-server-name")
+	settings.InsecureSkipVerify, _ = flags.GetBool("tls-skip-verify")
+
+	if settings == (types.VaultAuthTLS{}) {
+		return nil
+	}
+
+	return &settings
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/madwire-media/secrets-cli/project"
+	"github.com/madwire-media/secrets-cli/util"
+	"github.com/madwire-media/secrets-cli/vars"
+	"github.com/spf13/cobra"
+)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff [file]",
+	Short: "Show differences between remote secrets and local files",
+	Long: `Fetch the latest versions of secrets and show how the local copies differ from
+them, without pulling or pushing anything. Lines starting with '-' are only in
+the remote secret, lines starting with '+' are only in the local file, and
+lines starting with '~' are values that changed.
+
+Data secrets are diffed key by key and text secrets are diffed line by line.
+Secret values are masked unless the --reveal flag is enabled.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		openProject, err := project.OpenProject()
+		if err != nil {
+			fmt.Println("Error opening project:", err)
+			os.Exit(1)
+			return
+		}
+
+		reveal, _ := cmd.Flags().GetBool("reveal")
+		jobs, _ := cmd.Flags().GetInt("jobs")
+
+		filename := ""
+		if len(args) > 0 {
+			filename = args[0]
+		}
+
+		diffs, err := openProject.Diff(filename, reveal, jobs)
+		if err != nil {
+			fmt.Println("Error diffing secrets:", err)
+			os.Exit(1)
+			return
+		}
+
+		for _, diff := range diffs {
+			header := "diff " + diff.File
+			if vars.IsTTY {
+				header = "\x1b[1m" + header + "\x1b[0m"
+			}
+
+			fmt.Println(header)
+
+			if diff.Note != "" {
+				fmt.Println("    " + diff.Note)
+			} else {
+				fmt.Print(util.FormatDiff(diff.Lines, vars.IsTTY))
+			}
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+
+	diffCmd.Flags().Bool("reveal", false, "show secret values in the diff instead of masking them")
+	diffCmd.Flags().IntP("jobs", "j", project.DefaultJobs, "number of secrets to fetch at once")
+}
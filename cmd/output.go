@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/madwire-media/secrets-cli/project"
+	"github.com/spf13/cobra"
+)
+
+// Output formats for the --output flag
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+var outputFormat = outputText
+
+// jsonOutput is the real stdout, since everything else printed to stdout is
+// redirected to stderr in JSON mode
+var jsonOutput = os.Stdout
+
+type syncEventOutput struct {
+	Type string `json:"type"`
+	project.SyncEvent
+}
+
+type syncSummaryOutput struct {
+	Type string `json:"type"`
+	project.SyncSummary
+	Error string `json:"error,omitempty"`
+}
+
+type statusOutput struct {
+	Type string `json:"type"`
+	project.SecretStatus
+}
+
+type statusSummaryOutput struct {
+	Type      string `json:"type"`
+	Total     int    `json:"total"`
+	OutOfSync int    `json:"outOfSync"`
+	InSync    bool   `json:"inSync"`
+}
+
+func addOutputFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", outputText, "output format, either 'text' or 'json' (one JSON object per line, implies no prompts)")
+}
+
+// printJSON prints a value as a single line of JSON to the real stdout
+func printJSON(value interface{}) {
+	encoder := json.NewEncoder(jsonOutput)
+
+	// Errors can only come from unsupported values, which aren't used here
+	_ = encoder.Encode(value)
+}
+
+func printSyncJSON(openProject *project.Project, err error) {
+	for _, event := range openProject.SyncEvents() {
+		printJSON(syncEventOutput{"secret", event})
+	}
+
+	summary := syncSummaryOutput{
+		Type:        "summary",
+		SyncSummary: openProject.SyncSummary(),
+	}
+
+	if err != nil {
+		summary.Error = err.Error()
+	}
+
+	printJSON(summary)
+}
+
+func printStatusJSON(statuses []project.SecretStatus) {
+	summary := statusSummaryOutput{
+		Type:  "summary",
+		Total: len(statuses),
+	}
+
+	for _, status := range statuses {
+		printJSON(statusOutput{"secret", status})
+
+		if !status.InSync() {
+			summary.OutOfSync++
+		}
+	}
+
+	summary.InSync = summary.OutOfSync == 0
+
+	printJSON(summary)
+}
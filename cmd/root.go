@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"fmt"
+	"net/http"
 	"os"
 
 	"github.com/madwire-media/secrets-cli/types"
@@ -11,6 +12,8 @@ import (
 )
 
 var authFiles []string
+var verbose bool
+var quiet bool
 
 var rootCmd = &cobra.Command{
 	Use:   "secrets",
@@ -21,24 +24,73 @@ func init() {
 	cobra.OnInitialize(initSettings, autoUpdate)
 	rootCmd.PersistentFlags().StringArrayVar(&authFiles, "auth-config", []string{}, "one or more auth config files")
 	rootCmd.PersistentFlags().BoolVar(&vars.IsCICD, "cicd", false, "shortcut to streamline settings for CI/CD usage")
+	rootCmd.PersistentFlags().BoolVar(&vars.AllowHTTP, "allow-http", false, "allow connecting to Vault over plain http:// for local development")
+	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "print debug messages, including every HTTP request with credentials redacted")
+	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "only print warnings, errors, and prompts")
 }
 
 func initSettings() {
+	if outputFormat != outputText && outputFormat != outputJSON {
+		fmt.Println("Error: --output must be either 'text' or 'json'")
+		os.Exit(1)
+	}
+
+	if verbose && quiet {
+		fmt.Println("Error: --verbose and --quiet flags cannot both be enabled")
+		os.Exit(1)
+	}
+
+	if verbose {
+		util.Log.Level = util.LevelDebug
+	} else if quiet {
+		util.Log.Level = util.LevelQuiet
+	}
+
+	http.DefaultClient.Transport = util.TraceHTTP(http.DefaultClient.Transport)
+
 	// Don't do TTY things when CI/CD flag is enabled
 	if vars.IsCICD {
 		vars.IsTTY = false
 	}
 
-	// Load user auth if CI/CD flag is not enabled
+	// Keep stdout clean for JSON output, and don't prompt since there is
+	// probably a script reading it
+	if outputFormat == outputJSON {
+		vars.IsTTY = false
+		os.Stdout = os.Stderr
+	}
+
+	// Auth configs are merged from lowest to highest precedence: the Vault
+	// CLI's token file, the user auth config, the VAULT_* environment
+	// variables, and then the --auth-config files
+
+	// Load Vault CLI and user auth if CI/CD flag is not enabled
 	if !vars.IsCICD {
-		err := util.LoadUserAuth()
+		tokenFileAuth, err := util.GetVaultTokenFileAuth()
 		if err != nil {
-			panic(err)
+			util.Log.Errorf("could not load Vault token file: %s", err)
+			os.Exit(1)
+		}
+
+		util.MergeAuth(&vars.Auth, &tokenFileAuth)
+
+		err = util.LoadUserAuth()
+		if err != nil {
+			util.Log.Errorf("could not load user auth config: %s", err)
+			os.Exit(1)
 		}
 
 		util.MergeAuth(&vars.Auth, &vars.UserAuth)
 	}
 
+	envAuth, err := util.GetEnvAuth(&vars.Auth)
+	if err != nil {
+		util.Log.Errorf("could not load auth from environment: %s", err)
+		os.Exit(1)
+	}
+
+	util.MergeAuth(&vars.Auth, &envAuth)
+
 	// Load extra auth configs
 	for _, file := range authFiles {
 		var auth types.RootAuth
@@ -58,10 +110,10 @@ func initSettings() {
 }
 
 func autoUpdate() {
-	// Try updating if we aren't in CI/CD mode
-	if !vars.IsCICD {
+	// Try updating if we aren't in CI/CD mode or being read by a script
+	if !vars.IsCICD && outputFormat != outputJSON {
 		if err := util.TryAutoUpdateSelf(); err != nil {
-			fmt.Println(err.Error())
+			util.Log.Errorf("%s", err)
 		}
 	}
 }
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/madwire-media/secrets-cli/project"
+	"github.com/spf13/cobra"
+)
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the sync state of secrets in local project",
+	Long: `Fetch the latest versions of secrets and show which local copies are in sync,
+without pulling or pushing anything. Only classes saved in the local class file
+are included.
+
+Exits with status 0 if every secret is in sync, 2 if any secret is out of sync,
+or 1 if there was an error.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		openProject, err := project.OpenProject()
+		if err != nil {
+			fmt.Println("Error opening project:", err)
+			os.Exit(1)
+			return
+		}
+
+		jobs, _ := cmd.Flags().GetInt("jobs")
+
+		statuses, err := openProject.Status(jobs)
+		if err != nil {
+			fmt.Println("Error getting secret status:", err)
+			os.Exit(1)
+			return
+		}
+
+		inSync := true
+
+		for _, status := range statuses {
+			if outputFormat != outputJSON {
+				fmt.Printf("%-17s %s\n", status.State+":", status.File)
+			}
+
+			if !status.InSync() {
+				inSync = false
+			}
+		}
+
+		if outputFormat == outputJSON {
+			printStatusJSON(statuses)
+		}
+
+		if !inSync {
+			os.Exit(2)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+
+	statusCmd.Flags().IntP("jobs", "j", project.DefaultJobs, "number of secrets to fetch at once")
+	addOutputFlag(statusCmd)
+}
@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/madwire-media/secrets-cli/project"
+	"github.com/madwire-media/secrets-cli/vars"
 	"github.com/spf13/cobra"
 )
 
@@ -34,11 +35,17 @@ use. Secrets without an assigned class will always be synced.`,
 		pullOnly, _ := cmd.Flags().GetBool("pull")
 		pushOnly, _ := cmd.Flags().GetBool("push")
 		fixByDefault, _ := cmd.Flags().GetBool("fix")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		jobs, _ := cmd.Flags().GetInt("jobs")
+
+		vars.IsDryRun = dryRun
 
 		options := project.SyncOptions{
 			PullOnly:     pullOnly,
 			PushOnly:     pushOnly,
 			FixByDefault: fixByDefault,
+			DryRun:       dryRun,
+			Jobs:         jobs,
 			Classes: project.ClassUpdate{
 				FilterOptions: project.FilterOptions{
 					Add:      []string{},
@@ -66,6 +73,11 @@ use. Secrets without an assigned class will always be synced.`,
 		}
 
 		err = openProject.Sync(options)
+
+		if outputFormat == outputJSON {
+			printSyncJSON(openProject, err)
+		}
+
 		if err != nil {
 			fmt.Println("Error syncing secrets:", err)
 			os.Exit(1)
@@ -80,4 +92,7 @@ func init() {
 	syncCmd.Flags().Bool("pull", false, "prefer pulling remote secrets during conflicts, and don't push local changes")
 	syncCmd.Flags().Bool("push", false, "prefer pushing local changes during conflicts, and don't pull remote changes")
 	syncCmd.Flags().Bool("fix", false, "fix issues with secrets by default")
+	syncCmd.Flags().Bool("dry-run", false, "print what would be pulled, pushed, or deleted without changing anything")
+	syncCmd.Flags().IntP("jobs", "j", project.DefaultJobs, "number of secrets to fetch or push at once")
+	addOutputFlag(syncCmd)
 }
@@ -0,0 +1,197 @@
+package aws
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	serviceName   = "secretsmanager"
+	targetPrefix  = "secretsmanager."
+	jsonMediaType = "application/x-amz-json-1.1"
+	signAlgorithm = "AWS4-HMAC-SHA256"
+	amzDateFormat = "20060102T150405Z"
+
+	resourceNotFound = "ResourceNotFoundException"
+)
+
+// apiError is an error response from the Secrets Manager API
+type apiError struct {
+	Type    string `json:"__type"`
+	Message string `json:"message"`
+	status  string
+}
+
+func (err *apiError) Error() string {
+	return fmt.Sprintf("Got status %s from AWS Secrets Manager: %s: %s", err.status, err.Type, err.Message)
+}
+
+// isErrorType returns true if the error is an API error of the given type.
+// Error types may be prefixed with a namespace, i.e. "com.amazonaws...#Type"
+func isErrorType(err error, errorType string) bool {
+	switch v := err.(type) {
+	case *apiError:
+		return v.Type == errorType || strings.HasSuffix(v.Type, "#"+errorType)
+
+	default:
+		return false
+	}
+}
+
+type client struct {
+	endpoint *url.URL
+	region   string
+	creds    *credentials
+}
+
+func newClient(region, endpoint string, creds *credentials) (*client, error) {
+	if endpoint == "" {
+		endpoint = os.Getenv("AWS_ENDPOINT_URL")
+	}
+
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s.%s.amazonaws.com/", serviceName, region)
+	}
+
+	parsedEndpoint, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if parsedEndpoint.Path == "" {
+		parsedEndpoint.Path = "/"
+	}
+
+	return &client{
+		endpoint: parsedEndpoint,
+		region:   region,
+		creds:    creds,
+	}, nil
+}
+
+// call sends a signed request for a Secrets Manager API action and decodes the
+// response into output
+func (c *client) call(action string, input interface{}, output interface{}) error {
+	payload, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", c.endpoint.String(), bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", jsonMediaType)
+	req.Header.Set("X-Amz-Target", targetPrefix+action)
+
+	c.sign(req, payload, time.Now().UTC())
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != 200 {
+		errorData := apiError{}
+		json.Unmarshal(body, &errorData)
+		errorData.status = resp.Status
+
+		return &errorData
+	}
+
+	return json.Unmarshal(body, output)
+}
+
+// sign adds AWS Signature Version 4 headers to a request
+func (c *client) sign(req *http.Request, payload []byte, now time.Time) {
+	amzDate := now.Format(amzDateFormat)
+	shortDate := amzDate[:8]
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if c.creds.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.creds.sessionToken)
+	}
+
+	headers := map[string]string{
+		"host": req.URL.Host,
+	}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+
+	headerNames := make([]string, 0, len(headers))
+	for name := range headers {
+		headerNames = append(headerNames, name)
+	}
+	sort.Strings(headerNames)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range headerNames {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+
+	signedHeaders := strings.Join(headerNames, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		hashHex(payload),
+	}, "\n")
+
+	scope := strings.Join([]string{shortDate, c.region, serviceName, "aws4_request"}, "/")
+
+	stringToSign := strings.Join([]string{
+		signAlgorithm,
+		amzDate,
+		scope,
+		hashHex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+c.creds.secretAccessKey), shortDate)
+	key = hmacSHA256(key, c.region)
+	key = hmacSHA256(key, serviceName)
+	key = hmacSHA256(key, "aws4_request")
+
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		signAlgorithm,
+		c.creds.accessKeyID,
+		scope,
+		signedHeaders,
+		signature,
+	))
+}
+
+func hashHex(data []byte) string {
+	digest := sha256.Sum256(data)
+	return hex.EncodeToString(digest[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
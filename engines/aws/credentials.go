@@ -0,0 +1,155 @@
+package aws
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/madwire-media/secrets-cli/types"
+	"github.com/madwire-media/secrets-cli/util"
+	"github.com/madwire-media/secrets-cli/vars"
+)
+
+const defaultProfile = "default"
+
+type credentials struct {
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+}
+
+var (
+	loadedCredentials      = make(map[string]*credentials)
+	loadedCredentialsMutex sync.Mutex
+)
+
+func profileName(profile string) string {
+	if profile != "" {
+		return profile
+	}
+
+	if envProfile := os.Getenv("AWS_PROFILE"); envProfile != "" {
+		return envProfile
+	}
+
+	return defaultProfile
+}
+
+// loadCredentials finds credentials for a profile, checking the auth config
+// first, then the standard AWS environment variables, and then the shared AWS
+// credentials file
+func loadCredentials(profile string) (*credentials, error) {
+	profile = profileName(profile)
+
+	loadedCredentialsMutex.Lock()
+	defer loadedCredentialsMutex.Unlock()
+
+	if creds, ok := loadedCredentials[profile]; ok {
+		return creds, nil
+	}
+
+	creds, err := findCredentials(profile)
+	if err != nil {
+		return nil, err
+	}
+
+	loadedCredentials[profile] = creds
+
+	return creds, nil
+}
+
+func findCredentials(profile string) (*credentials, error) {
+	if vars.Auth.AWS != nil {
+		if awsAuth, ok := (*vars.Auth.AWS)[profile]; ok {
+			awsAuth, ok = util.LoadAWSAuthCredentials(profile, awsAuth)
+			if ok {
+				return credentialsFromAuth(&awsAuth)
+			}
+		}
+	}
+
+	if accessKeyID := os.Getenv("AWS_ACCESS_KEY_ID"); accessKeyID != "" {
+		return &credentials{
+			accessKeyID:     accessKeyID,
+			secretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			sessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}, nil
+	}
+
+	filename := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if filename == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+
+		filename = filepath.Join(home, ".aws", "credentials")
+	}
+
+	text, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("no AWS credentials for profile '%s'", profile)
+	}
+
+	values := parseCredentialsFile(text)[profile]
+	if values == nil {
+		return nil, fmt.Errorf("no AWS credentials for profile '%s' in '%s'", profile, filename)
+	}
+
+	return credentialsFromAuth(&types.AWSAuth{
+		AccessKeyID:     values["aws_access_key_id"],
+		SecretAccessKey: values["aws_secret_access_key"],
+		SessionToken:    values["aws_session_token"],
+	})
+}
+
+func credentialsFromAuth(awsAuth *types.AWSAuth) (*credentials, error) {
+	if awsAuth.AccessKeyID == "" || awsAuth.SecretAccessKey == "" {
+		return nil, errors.New("AWS credentials are missing an access key ID or secret access key")
+	}
+
+	return &credentials{
+		accessKeyID:     awsAuth.AccessKeyID,
+		secretAccessKey: awsAuth.SecretAccessKey,
+		sessionToken:    awsAuth.SessionToken,
+	}, nil
+}
+
+// parseCredentialsFile parses the INI-like shared AWS credentials file into a
+// map of profiles to keys and values
+func parseCredentialsFile(text []byte) map[string]map[string]string {
+	profiles := make(map[string]map[string]string)
+	var current map[string]string
+
+	scanner := bufio.NewScanner(bytes.NewReader(text))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			current = make(map[string]string)
+			profiles[name] = current
+			continue
+		}
+
+		eqIdx := strings.Index(line, "=")
+		if eqIdx == -1 || current == nil {
+			continue
+		}
+
+		key := strings.ToLower(strings.TrimSpace(line[:eqIdx]))
+		current[key] = strings.TrimSpace(line[eqIdx+1:])
+	}
+
+	return profiles
+}
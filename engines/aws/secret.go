@@ -0,0 +1,363 @@
+package aws
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/madwire-media/secrets-cli/engines"
+	"github.com/madwire-media/secrets-cli/engines/mapping"
+	"github.com/madwire-media/secrets-cli/types"
+)
+
+const defaultVersionStage = "AWSCURRENT"
+
+func init() {
+	engines.Register("aws", func() engines.Engine {
+		return &SecretConfig{}
+	})
+}
+
+type secretValue struct {
+	ARN           string   `json:"ARN"`
+	Name          string   `json:"Name"`
+	VersionID     string   `json:"VersionId"`
+	SecretString  *string  `json:"SecretString"`
+	VersionStages []string `json:"VersionStages"`
+}
+
+// FetchedAWSSecret is an implementation of types.FetchedSecret specifically
+// for a secret fetched from AWS Secrets Manager
+type FetchedAWSSecret struct {
+	value         interface{}
+	version       string
+	format        int
+	isMissingData bool
+
+	config  *SecretConfig
+	client  *client
+	mapping mapping.Mapping
+}
+
+// Value returns the fetched secret value or sub-value
+func (fetched *FetchedAWSSecret) Value() interface{} {
+	return fetched.value
+}
+
+// Version returns the ID of the secret version the configured version stage
+// pointed to when it was fetched
+func (fetched *FetchedAWSSecret) Version() interface{} {
+	return fetched.version
+}
+
+// Format returns the configured format for this secret
+func (fetched *FetchedAWSSecret) Format() int {
+	return fetched.format
+}
+
+// IsMissingData returns true if the remote secret existed but was incomplete
+func (fetched *FetchedAWSSecret) IsMissingData() bool {
+	return fetched.isMissingData
+}
+
+// FetchVersion fetches an older version of this secret by its version ID
+func (fetched *FetchedAWSSecret) FetchVersion(version interface{}) (interface{}, bool, error) {
+	versionID, ok := version.(string)
+	if !ok || versionID == "" {
+		return nil, false, nil
+	}
+
+	value, err := fetched.config.getSecretValueVersion(fetched.client, versionID)
+	if isErrorType(err, resourceNotFound) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	document, err := parseDocument(value)
+	if err != nil {
+		return nil, false, err
+	}
+
+	extracted, isMissingData, err := fetched.mapping.Extract(document)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return extracted, !isMissingData, nil
+}
+
+// UploadNew modifies the remote secret and replaces the value or sub-value with
+// a new given value, and returns the new secret version ID.
+//
+// Secrets Manager has no check-and-set writes, so the latest secret is read
+// right before the new version is written to keep the window for lost updates
+// as small as possible
+func (fetched *FetchedAWSSecret) UploadNew(value interface{}) (interface{}, error) {
+	type putSecretInput struct {
+		SecretID           string   `json:"SecretId"`
+		ClientRequestToken string   `json:"ClientRequestToken"`
+		SecretString       string   `json:"SecretString"`
+		VersionStages      []string `json:"VersionStages"`
+	}
+
+	type createSecretInput struct {
+		Name               string `json:"Name"`
+		ClientRequestToken string `json:"ClientRequestToken"`
+		SecretString       string `json:"SecretString"`
+	}
+
+	type writeOutput struct {
+		VersionID string `json:"VersionId"`
+	}
+
+	// Get the latest secret data
+	current, err := fetched.config.getSecretValue(fetched.client)
+	if err != nil && !isErrorType(err, resourceNotFound) {
+		return nil, err
+	}
+
+	exists := err == nil
+
+	var document map[string]interface{}
+
+	if exists {
+		document, err = parseDocument(current)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		document = make(map[string]interface{})
+	}
+
+	// Modify the secret based on the mapping
+	document, err = fetched.mapping.Apply(document, value)
+	if err != nil {
+		return nil, err
+	}
+
+	secretString, err := json.Marshal(document)
+	if err != nil {
+		return nil, err
+	}
+
+	requestToken, err := newRequestToken()
+	if err != nil {
+		return nil, err
+	}
+
+	var output writeOutput
+
+	if exists {
+		err = fetched.client.call("PutSecretValue", putSecretInput{
+			SecretID:           fetched.config.SecretID,
+			ClientRequestToken: requestToken,
+			SecretString:       string(secretString),
+			VersionStages:      []string{fetched.config.versionStage()},
+		}, &output)
+	} else {
+		if strings.HasPrefix(fetched.config.SecretID, "arn:") {
+			return nil, fmt.Errorf("cannot create new secret from ARN '%s', use a secret name instead", fetched.config.SecretID)
+		}
+
+		if fetched.config.versionStage() != defaultVersionStage {
+			return nil, fmt.Errorf("cannot create new secret '%s' with version stage '%s'", fetched.config.SecretID, fetched.config.versionStage())
+		}
+
+		err = fetched.client.call("CreateSecret", createSecretInput{
+			Name:               fetched.config.SecretID,
+			ClientRequestToken: requestToken,
+			SecretString:       string(secretString),
+		}, &output)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return output.VersionID, nil
+}
+
+// SecretConfig contains the AWS-specific configuration parameters for a secret
+// in secrets.yaml
+type SecretConfig struct {
+	SecretID     string          `yaml:"secretID"`
+	Region       string          `yaml:"region,omitempty"`
+	VersionStage string          `yaml:"versionStage,omitempty"`
+	Profile      string          `yaml:"profile,omitempty"`
+	Endpoint     string          `yaml:"endpoint,omitempty"`
+	Mapping      mapping.Mapping `yaml:"mapping"`
+}
+
+// Prepare ensures that a region and credentials are available for this secret
+func (secretConfig *SecretConfig) Prepare() error {
+	if secretConfig.SecretID == "" {
+		return errors.New("no secretID provided for AWS secret")
+	}
+
+	if secretConfig.region() == "" {
+		return fmt.Errorf("no region provided for AWS secret '%s'", secretConfig.SecretID)
+	}
+
+	_, err := loadCredentials(secretConfig.Profile)
+	return err
+}
+
+// Describe returns the secret ID and region of this secret
+func (secretConfig *SecretConfig) Describe() string {
+	if strings.HasPrefix(secretConfig.SecretID, "arn:") {
+		return secretConfig.SecretID
+	}
+
+	return "aws:" + secretConfig.region() + ":" + secretConfig.SecretID
+}
+
+// Fetch downloads this secret and returns an instance of FetchedAWSSecret
+func (secretConfig *SecretConfig) Fetch() (types.FetchedSecret, error) {
+	var secret FetchedAWSSecret
+	var err error
+
+	// Compute the format first in case of an early exit (i.e. not found)
+	secret.format, err = secretConfig.Mapping.Format()
+	if err != nil {
+		return nil, err
+	}
+
+	secret.config = secretConfig
+	secret.mapping = secretConfig.Mapping
+
+	creds, err := loadCredentials(secretConfig.Profile)
+	if err != nil {
+		return nil, err
+	}
+
+	secret.client, err = newClient(secretConfig.region(), secretConfig.Endpoint, creds)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get the secret data
+	value, err := secretConfig.getSecretValue(secret.client)
+	if isErrorType(err, resourceNotFound) {
+		secret.isMissingData = true
+		return &secret, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	secret.version = value.VersionID
+
+	document, err := parseDocument(value)
+	if err != nil {
+		return nil, err
+	}
+
+	// Process secret data
+	secret.value, secret.isMissingData, err = secretConfig.Mapping.Extract(document)
+	if err != nil {
+		return nil, err
+	}
+
+	return &secret, nil
+}
+
+type getSecretValueInput struct {
+	SecretID     string `json:"SecretId"`
+	VersionID    string `json:"VersionId,omitempty"`
+	VersionStage string `json:"VersionStage,omitempty"`
+}
+
+func (secretConfig *SecretConfig) getSecretValue(c *client) (*secretValue, error) {
+	var value secretValue
+
+	err := c.call("GetSecretValue", getSecretValueInput{
+		SecretID:     secretConfig.SecretID,
+		VersionStage: secretConfig.versionStage(),
+	}, &value)
+	if err != nil {
+		return nil, err
+	}
+
+	return &value, nil
+}
+
+func (secretConfig *SecretConfig) getSecretValueVersion(c *client, versionID string) (*secretValue, error) {
+	var value secretValue
+
+	err := c.call("GetSecretValue", getSecretValueInput{
+		SecretID:  secretConfig.SecretID,
+		VersionID: versionID,
+	}, &value)
+	if err != nil {
+		return nil, err
+	}
+
+	return &value, nil
+}
+
+func (secretConfig *SecretConfig) versionStage() string {
+	if secretConfig.VersionStage != "" {
+		return secretConfig.VersionStage
+	}
+
+	return defaultVersionStage
+}
+
+// region returns the configured region, the region from the secret's ARN, or
+// the region from the standard AWS environment variables, in that order
+func (secretConfig *SecretConfig) region() string {
+	if secretConfig.Region != "" {
+		return secretConfig.Region
+	}
+
+	// arn:<partition>:secretsmanager:<region>:<account>:secret:<name>
+	if strings.HasPrefix(secretConfig.SecretID, "arn:") {
+		parts := strings.SplitN(secretConfig.SecretID, ":", 6)
+		if len(parts) == 6 && parts[3] != "" {
+			return parts[3]
+		}
+	}
+
+	if region := os.Getenv("AWS_REGION"); region != "" {
+		return region
+	}
+
+	return os.Getenv("AWS_DEFAULT_REGION")
+}
+
+func parseDocument(value *secretValue) (map[string]interface{}, error) {
+	if value.SecretString == nil {
+		return nil, fmt.Errorf("AWS secret '%s' has no secret string, binary secrets are not supported", value.Name)
+	}
+
+	var document map[string]interface{}
+
+	err := json.Unmarshal([]byte(*value.SecretString), &document)
+	if err != nil {
+		return nil, fmt.Errorf("AWS secret '%s' is not a JSON object: %s", value.Name, err.Error())
+	}
+
+	if document == nil {
+		document = make(map[string]interface{})
+	}
+
+	return document, nil
+}
+
+// newRequestToken generates a random UUID to make writes idempotent
+func newRequestToken() (string, error) {
+	var raw [16]byte
+
+	_, err := rand.Read(raw[:])
+	if err != nil {
+		return "", err
+	}
+
+	raw[6] = (raw[6] & 0x0f) | 0x40
+	raw[8] = (raw[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", raw[0:4], raw[4:6], raw[6:8], raw[8:10], raw[10:]), nil
+}
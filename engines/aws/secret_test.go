@@ -0,0 +1,505 @@
+package aws
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/madwire-media/secrets-cli/engines/mapping"
+)
+
+const (
+	testAccessKeyID     = "AKIDEXAMPLE"
+	testSecretAccessKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+	testRegion          = "us-east-1"
+)
+
+// fakeVersion is a version of a secret stored by fakeSecretsManager
+type fakeVersion struct {
+	id     string
+	value  string
+	stages []string
+}
+
+// fakeSecretsManager is a Secrets Manager API that keeps secrets in memory and
+// checks the signature of every request
+type fakeSecretsManager struct {
+	t *testing.T
+
+	mutex    sync.Mutex
+	secrets  map[string][]*fakeVersion
+	requests []fakeRequest
+}
+
+// fakeRequest is an API call received by fakeSecretsManager
+type fakeRequest struct {
+	action string
+	input  map[string]interface{}
+}
+
+func newFakeSecretsManager(t *testing.T) (*fakeSecretsManager, *httptest.Server) {
+	fake := &fakeSecretsManager{
+		t:       t,
+		secrets: make(map[string][]*fakeVersion),
+	}
+
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	t.Setenv("AWS_ACCESS_KEY_ID", testAccessKeyID)
+	t.Setenv("AWS_SECRET_ACCESS_KEY", testSecretAccessKey)
+	t.Setenv("AWS_SESSION_TOKEN", "")
+	t.Setenv("AWS_PROFILE", "")
+
+	// Credentials are cached per profile, so clear them for the environment
+	// above to be used
+	loadedCredentialsMutex.Lock()
+	loadedCredentials = make(map[string]*credentials)
+	loadedCredentialsMutex.Unlock()
+
+	return fake, server
+}
+
+func (fake *fakeSecretsManager) put(name string, value string, stages ...string) string {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	return fake.putLocked(name, value, stages)
+}
+
+// putLocked adds a new version of a secret, moving its stages away from the
+// versions that had them before
+func (fake *fakeSecretsManager) putLocked(name string, value string, stages []string) string {
+	versions := fake.secrets[name]
+
+	for _, version := range versions {
+		kept := []string{}
+
+		for _, stage := range version.stages {
+			if !containsString(stages, stage) {
+				kept = append(kept, stage)
+			}
+		}
+
+		version.stages = kept
+	}
+
+	id := fmt.Sprintf("%s-v%d", name, len(versions)+1)
+	fake.secrets[name] = append(versions, &fakeVersion{
+		id:     id,
+		value:  value,
+		stages: stages,
+	})
+
+	return id
+}
+
+func (fake *fakeSecretsManager) calls(action string) []map[string]interface{} {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	inputs := []map[string]interface{}{}
+
+	for _, request := range fake.requests {
+		if request.action == action {
+			inputs = append(inputs, request.input)
+		}
+	}
+
+	return inputs
+}
+
+func (fake *fakeSecretsManager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		fake.t.Errorf("could not read request body: %s", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := checkSignature(r, body); err != nil {
+		fake.t.Errorf("invalid signature: %s", err)
+		writeFakeError(w, http.StatusForbidden, "InvalidSignatureException")
+		return
+	}
+
+	action := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), targetPrefix)
+
+	var input map[string]interface{}
+
+	err = json.Unmarshal(body, &input)
+	if err != nil {
+		fake.t.Errorf("request body is not JSON: %s", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	fake.requests = append(fake.requests, fakeRequest{action, input})
+
+	switch action {
+	case "GetSecretValue":
+		name, _ := input["SecretId"].(string)
+		versionID, _ := input["VersionId"].(string)
+		stage, _ := input["VersionStage"].(string)
+
+		for _, version := range fake.secrets[name] {
+			if (versionID != "" && version.id == versionID) || (versionID == "" && containsString(version.stages, stage)) {
+				writeFakeJSON(w, map[string]interface{}{
+					"Name":          name,
+					"VersionId":     version.id,
+					"SecretString":  version.value,
+					"VersionStages": version.stages,
+				})
+				return
+			}
+		}
+
+		writeFakeError(w, http.StatusBadRequest, resourceNotFound)
+
+	case "PutSecretValue":
+		name, _ := input["SecretId"].(string)
+		value, _ := input["SecretString"].(string)
+
+		if _, ok := fake.secrets[name]; !ok {
+			writeFakeError(w, http.StatusBadRequest, resourceNotFound)
+			return
+		}
+
+		stages := []string{}
+		if rawStages, ok := input["VersionStages"].([]interface{}); ok {
+			for _, stage := range rawStages {
+				stages = append(stages, stage.(string))
+			}
+		}
+
+		writeFakeJSON(w, map[string]interface{}{
+			"VersionId": fake.putLocked(name, value, stages),
+		})
+
+	case "CreateSecret":
+		name, _ := input["Name"].(string)
+		value, _ := input["SecretString"].(string)
+
+		if _, ok := fake.secrets[name]; ok {
+			writeFakeError(w, http.StatusBadRequest, "ResourceExistsException")
+			return
+		}
+
+		writeFakeJSON(w, map[string]interface{}{
+			"VersionId": fake.putLocked(name, value, []string{defaultVersionStage}),
+		})
+
+	default:
+		fake.t.Errorf("unexpected action '%s'", action)
+		writeFakeError(w, http.StatusBadRequest, "InvalidAction")
+	}
+}
+
+// checkSignature verifies the SigV4 Authorization header of a request, building
+// the canonical request from what was received
+func checkSignature(r *http.Request, body []byte) error {
+	authorization := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, signAlgorithm+" ") {
+		return fmt.Errorf("unexpected Authorization header '%s'", authorization)
+	}
+
+	fields := make(map[string]string)
+	for _, field := range strings.Split(strings.TrimPrefix(authorization, signAlgorithm+" "), ", ") {
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("malformed Authorization field '%s'", field)
+		}
+
+		fields[parts[0]] = parts[1]
+	}
+
+	amzDate := r.Header.Get("X-Amz-Date")
+	if len(amzDate) != len(amzDateFormat) {
+		return fmt.Errorf("unexpected X-Amz-Date header '%s'", amzDate)
+	}
+
+	scope := strings.Join([]string{amzDate[:8], testRegion, serviceName, "aws4_request"}, "/")
+	if fields["Credential"] != testAccessKeyID+"/"+scope {
+		return fmt.Errorf("unexpected credential '%s'", fields["Credential"])
+	}
+
+	signedHeaders := strings.Split(fields["SignedHeaders"], ";")
+	if !sort.StringsAreSorted(signedHeaders) {
+		return fmt.Errorf("signed headers '%s' are not sorted", fields["SignedHeaders"])
+	}
+
+	for _, required := range []string{"content-type", "host", "x-amz-date", "x-amz-target"} {
+		if !containsString(signedHeaders, required) {
+			return fmt.Errorf("header '%s' is not signed", required)
+		}
+	}
+
+	var canonicalHeaders strings.Builder
+	for _, name := range signedHeaders {
+		value := r.Header.Get(name)
+		if name == "host" {
+			value = r.Host
+		}
+
+		canonicalHeaders.WriteString(name + ":" + value + "\n")
+	}
+
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		r.URL.EscapedPath(),
+		r.URL.RawQuery,
+		canonicalHeaders.String(),
+		fields["SignedHeaders"],
+		hashHex(body),
+	}, "\n")
+
+	stringToSign := strings.Join([]string{
+		signAlgorithm,
+		amzDate,
+		scope,
+		hashHex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+testSecretAccessKey), amzDate[:8])
+	key = hmacSHA256(key, testRegion)
+	key = hmacSHA256(key, serviceName)
+	key = hmacSHA256(key, "aws4_request")
+
+	if signature := hex.EncodeToString(hmacSHA256(key, stringToSign)); fields["Signature"] != signature {
+		return fmt.Errorf("signature '%s' does not match expected '%s'", fields["Signature"], signature)
+	}
+
+	return nil
+}
+
+func writeFakeJSON(w http.ResponseWriter, output interface{}) {
+	w.Header().Set("Content-Type", jsonMediaType)
+	json.NewEncoder(w).Encode(output)
+}
+
+func writeFakeError(w http.ResponseWriter, status int, errorType string) {
+	w.Header().Set("Content-Type", jsonMediaType)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"__type":  errorType,
+		"message": "fake " + errorType,
+	})
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func textMapping(path ...interface{}) mapping.Mapping {
+	return mapping.Mapping{
+		FromText: &mapping.FromTextMapping{
+			Path: path,
+		},
+	}
+}
+
+func TestSignedRequest(t *testing.T) {
+	fake, server := newFakeSecretsManager(t)
+	t.Setenv("AWS_SESSION_TOKEN", "session-token")
+
+	fake.put("app", `{"env":"A=1"}`, defaultVersionStage)
+
+	var requestHeaders http.Header
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestHeaders = r.Header.Clone()
+		fake.ServeHTTP(w, r)
+	})
+
+	secretConfig := &SecretConfig{
+		SecretID: "app",
+		Region:   testRegion,
+		Endpoint: server.URL,
+		Mapping:  textMapping("env"),
+	}
+
+	_, err := secretConfig.Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token := requestHeaders.Get("X-Amz-Security-Token"); token != "session-token" {
+		t.Errorf("expected session token header, got '%s'", token)
+	}
+
+	if authorization := requestHeaders.Get("Authorization"); !strings.Contains(authorization, "SignedHeaders=content-type;host;x-amz-date;x-amz-security-token;x-amz-target,") {
+		t.Errorf("unexpected signed headers in '%s'", authorization)
+	}
+
+	if target := requestHeaders.Get("X-Amz-Target"); target != "secretsmanager.GetSecretValue" {
+		t.Errorf("unexpected target '%s'", target)
+	}
+}
+
+func TestFetchAndUploadWithVersionStage(t *testing.T) {
+	fake, server := newFakeSecretsManager(t)
+	t.Setenv("AWS_ENDPOINT_URL", server.URL)
+
+	fake.put("app", `{"env":"A=1","other":"kept"}`, defaultVersionStage)
+	pendingID := fake.put("app", `{"env":"A=2","other":"kept"}`, "AWSPENDING")
+
+	secretConfig := &SecretConfig{
+		SecretID:     "app",
+		Region:       testRegion,
+		VersionStage: "AWSPENDING",
+		Mapping:      textMapping("env"),
+	}
+
+	fetched, err := secretConfig.Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fetched.IsMissingData() {
+		t.Fatal("expected fetched secret to have data")
+	}
+
+	if fetched.Value() != "A=2" {
+		t.Errorf("expected value from AWSPENDING version, got '%v'", fetched.Value())
+	}
+
+	if fetched.Version() != pendingID {
+		t.Errorf("expected version '%s', got '%v'", pendingID, fetched.Version())
+	}
+
+	gets := fake.calls("GetSecretValue")
+	if len(gets) != 1 || gets[0]["VersionStage"] != "AWSPENDING" {
+		t.Errorf("expected GetSecretValue with version stage AWSPENDING, got %v", gets)
+	}
+
+	newVersion, err := fetched.UploadNew("A=3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	puts := fake.calls("PutSecretValue")
+	if len(puts) != 1 {
+		t.Fatalf("expected 1 PutSecretValue call, got %d", len(puts))
+	}
+
+	if stages, _ := puts[0]["VersionStages"].([]interface{}); len(stages) != 1 || stages[0] != "AWSPENDING" {
+		t.Errorf("expected PutSecretValue with version stage AWSPENDING, got %v", puts[0]["VersionStages"])
+	}
+
+	if puts[0]["SecretString"] != `{"env":"A=3","other":"kept"}` {
+		t.Errorf("expected other keys to be kept, got '%v'", puts[0]["SecretString"])
+	}
+
+	if token, _ := puts[0]["ClientRequestToken"].(string); len(token) != 36 {
+		t.Errorf("expected a UUID client request token, got '%s'", token)
+	}
+
+	refetched, err := secretConfig.Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if refetched.Value() != "A=3" || refetched.Version() != newVersion {
+		t.Errorf("expected new value and version '%v', got '%v' at '%v'", newVersion, refetched.Value(), refetched.Version())
+	}
+
+	// The current version isn't touched by pushes to another stage
+	current := &SecretConfig{
+		SecretID: "app",
+		Region:   testRegion,
+		Mapping:  textMapping("env"),
+	}
+
+	fetchedCurrent, err := current.Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fetchedCurrent.Value() != "A=1" {
+		t.Errorf("expected AWSCURRENT value to be unchanged, got '%v'", fetchedCurrent.Value())
+	}
+}
+
+func TestUploadCreatesMissingSecret(t *testing.T) {
+	fake, server := newFakeSecretsManager(t)
+
+	secretConfig := &SecretConfig{
+		SecretID: "new-app",
+		Region:   testRegion,
+		Endpoint: server.URL,
+		Mapping:  textMapping("env"),
+	}
+
+	fetched, err := secretConfig.Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !fetched.IsMissingData() {
+		t.Fatal("expected missing secret to be missing data")
+	}
+
+	newVersion, err := fetched.UploadNew("A=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(fake.calls("PutSecretValue")) != 0 {
+		t.Error("expected no PutSecretValue call for a missing secret")
+	}
+
+	creates := fake.calls("CreateSecret")
+	if len(creates) != 1 || creates[0]["Name"] != "new-app" || creates[0]["SecretString"] != `{"env":"A=1"}` {
+		t.Fatalf("expected CreateSecret for 'new-app', got %v", creates)
+	}
+
+	refetched, err := secretConfig.Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if refetched.Value() != "A=1" || refetched.Version() != newVersion {
+		t.Errorf("expected created value and version '%v', got '%v' at '%v'", newVersion, refetched.Value(), refetched.Version())
+	}
+}
+
+func TestUploadRefusesToCreateWithVersionStage(t *testing.T) {
+	fake, server := newFakeSecretsManager(t)
+
+	secretConfig := &SecretConfig{
+		SecretID:     "new-app",
+		Region:       testRegion,
+		VersionStage: "AWSPENDING",
+		Endpoint:     server.URL,
+		Mapping:      textMapping("env"),
+	}
+
+	fetched, err := secretConfig.Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = fetched.UploadNew("A=1")
+	if err == nil {
+		t.Fatal("expected an error creating a secret with a version stage")
+	}
+
+	if len(fake.calls("CreateSecret")) != 0 {
+		t.Error("expected no CreateSecret call")
+	}
+}
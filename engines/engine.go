@@ -0,0 +1,95 @@
+package engines
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/madwire-media/secrets-cli/types"
+)
+
+// Engine is the engine-specific configuration for a secret in secrets.yaml.
+// Every secret engine provides its own implementation, which is decoded from
+// the YAML key the engine was registered with
+type Engine interface {
+	// Prepare prepares this secret for fetching, for example by getting auth
+	// credentials from the user and generating a valid login session
+	Prepare() error
+
+	// Fetch fetches this secret from the remote server, returning an
+	// interface capable of uploading a new version of this secret as well
+	Fetch() (types.FetchedSecret, error)
+
+	// Describe returns a short, human-readable description of where this
+	// secret is stored, i.e. a URL
+	Describe() string
+}
+
+// DynamicEngine is implemented by engine configs that may issue a brand new
+// secret every time they're fetched, so that read-only operations can avoid
+// fetching them
+type DynamicEngine interface {
+	Engine
+
+	// IsDynamic returns true if fetching this secret issues a new secret
+	IsDynamic() bool
+}
+
+// Factory creates a new, empty engine config for YAML to be decoded into. It
+// must return a pointer type
+type Factory func() Engine
+
+var registry = make(map[string]Factory)
+
+// Register adds a secret engine to the registry under the given secrets.yaml
+// key. This is meant to be called from the init() function of an engine
+// package, and it panics if the key is already registered
+func Register(key string, factory Factory) {
+	if factory == nil {
+		panic("engines: Register factory is nil for key " + key)
+	}
+
+	if _, exists := registry[key]; exists {
+		panic("engines: Register called twice for key " + key)
+	}
+
+	registry[key] = factory
+}
+
+// New creates an empty engine config for the given secrets.yaml key, returning
+// false if no engine is registered under that key
+func New(key string) (Engine, bool) {
+	factory, ok := registry[key]
+	if !ok {
+		return nil, false
+	}
+
+	return factory(), true
+}
+
+// Keys returns every registered secrets.yaml key in sorted order
+func Keys() []string {
+	keys := make([]string, 0, len(registry))
+
+	for key := range registry {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// KeyOf returns the secrets.yaml key an engine config was registered with by
+// comparing its type against every registered factory
+func KeyOf(engine Engine) (string, error) {
+	engineType := reflect.TypeOf(engine)
+
+	for key, factory := range registry {
+		if reflect.TypeOf(factory()) == engineType {
+			return key, nil
+		}
+	}
+
+	return "", fmt.Errorf("secret engine type %s is not registered", engineType)
+}
@@ -0,0 +1,197 @@
+package local
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/madwire-media/secrets-cli/util"
+	"github.com/madwire-media/secrets-cli/vars"
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+const (
+	keyEnvVar      = "SECRETS_LOCAL_KEY"
+	defaultKeyFile = "local.key"
+
+	keySize   = 32
+	nonceSize = 24
+)
+
+var (
+	loadedKeys      = make(map[string]*[keySize]byte)
+	loadedKeysMutex sync.Mutex
+)
+
+// resolveKeyFile returns the path of the key file for a store, or an empty
+// string if the key comes from the environment
+func (secretConfig *SecretConfig) resolveKeyFile() (string, error) {
+	if secretConfig.KeyFile != "" {
+		return resolvePath(secretConfig.KeyFile), nil
+	}
+
+	if os.Getenv(keyEnvVar) != "" {
+		return "", nil
+	}
+
+	dir, err := util.GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, defaultKeyFile), nil
+}
+
+// ensureKey loads the key for this secret, offering to generate a new one if
+// it doesn't exist yet. Nothing is generated in dry-run mode, since that would
+// write the key file
+func (secretConfig *SecretConfig) ensureKey() error {
+	filename, err := secretConfig.resolveKeyFile()
+	if err != nil {
+		return err
+	}
+
+	loadedKeysMutex.Lock()
+	defer loadedKeysMutex.Unlock()
+
+	if _, ok := loadedKeys[filename]; ok {
+		return nil
+	}
+
+	if filename == "" {
+		key, err := decodeKey(os.Getenv(keyEnvVar))
+		if err != nil {
+			return fmt.Errorf("invalid key in %s: %s", keyEnvVar, err.Error())
+		}
+
+		loadedKeys[filename] = key
+		return nil
+	}
+
+	text, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		if vars.IsDryRun {
+			return fmt.Errorf("no local secret store key at '%s', run without --dry-run to generate one", filename)
+		}
+
+		if !vars.IsTTY {
+			return fmt.Errorf("no local secret store key at '%s', set %s or generate one in a TTY", filename, keyEnvVar)
+		}
+
+		util.PromptMutex.Lock()
+		fmt.Printf("No local secret store key at '%s', would you like to generate one?\n", filename)
+		shouldGenerate := util.CliQuestionYesNoDefault("Generate key?", true)
+		util.PromptMutex.Unlock()
+
+		if !shouldGenerate {
+			return fmt.Errorf("no local secret store key at '%s'", filename)
+		}
+
+		key, err := generateKey(filename)
+		if err != nil {
+			return err
+		}
+
+		loadedKeys[filename] = key
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	key, err := decodeKey(string(text))
+	if err != nil {
+		return fmt.Errorf("invalid key in '%s': %s", filename, err.Error())
+	}
+
+	loadedKeys[filename] = key
+	return nil
+}
+
+func (secretConfig *SecretConfig) key() (*[keySize]byte, error) {
+	filename, err := secretConfig.resolveKeyFile()
+	if err != nil {
+		return nil, err
+	}
+
+	loadedKeysMutex.Lock()
+	key, ok := loadedKeys[filename]
+	loadedKeysMutex.Unlock()
+
+	if !ok {
+		return nil, errors.New("local secret store key not loaded, was Prepare called?")
+	}
+
+	return key, nil
+}
+
+func decodeKey(encoded string) (*[keySize]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(raw) != keySize {
+		return nil, fmt.Errorf("key must be %d bytes, got %d", keySize, len(raw))
+	}
+
+	var key [keySize]byte
+	copy(key[:], raw)
+
+	return &key, nil
+}
+
+func generateKey(filename string) (*[keySize]byte, error) {
+	var key [keySize]byte
+
+	_, err := rand.Read(key[:])
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.MkdirAll(filepath.Dir(filename), 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(key[:]) + "\n"
+
+	err = ioutil.WriteFile(filename, []byte(encoded), 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &key, nil
+}
+
+func encrypt(key *[keySize]byte, plaintext []byte) ([]byte, error) {
+	var nonce [nonceSize]byte
+
+	_, err := rand.Read(nonce[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return secretbox.Seal(nonce[:], plaintext, &nonce, key), nil
+}
+
+func decrypt(key *[keySize]byte, ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < nonceSize {
+		return nil, errors.New("encrypted secret is too short")
+	}
+
+	var nonce [nonceSize]byte
+	copy(nonce[:], ciphertext[:nonceSize])
+
+	plaintext, ok := secretbox.Open(nil, ciphertext[nonceSize:], &nonce, key)
+	if !ok {
+		return nil, errors.New("could not decrypt secret, is the key correct?")
+	}
+
+	return plaintext, nil
+}
@@ -0,0 +1,213 @@
+package local
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/madwire-media/secrets-cli/engines"
+	"github.com/madwire-media/secrets-cli/engines/mapping"
+	"github.com/madwire-media/secrets-cli/types"
+	"github.com/madwire-media/secrets-cli/util"
+)
+
+func init() {
+	engines.Register("local", func() engines.Engine {
+		return &SecretConfig{}
+	})
+}
+
+// FetchedLocalSecret is an implementation of types.FetchedSecret specifically
+// for a secret fetched from a local encrypted secret store
+type FetchedLocalSecret struct {
+	value         interface{}
+	version       int
+	format        int
+	isMissingData bool
+
+	config  *SecretConfig
+	mapping mapping.Mapping
+}
+
+// Value returns the fetched secret value or sub-value
+func (fetched *FetchedLocalSecret) Value() interface{} {
+	return fetched.value
+}
+
+// Version returns the fetched secret's version
+func (fetched *FetchedLocalSecret) Version() interface{} {
+	return fetched.version
+}
+
+// Format returns the configured format for this secret
+func (fetched *FetchedLocalSecret) Format() int {
+	return fetched.format
+}
+
+// IsMissingData returns true if the remote secret existed but was incomplete
+func (fetched *FetchedLocalSecret) IsMissingData() bool {
+	return fetched.isMissingData
+}
+
+// FetchVersion decrypts an older version of this secret
+func (fetched *FetchedLocalSecret) FetchVersion(version interface{}) (interface{}, bool, error) {
+	versionNumber, ok := version.(int)
+	if !ok || versionNumber < 1 {
+		return nil, false, nil
+	}
+
+	key, err := fetched.config.key()
+	if err != nil {
+		return nil, false, err
+	}
+
+	dir := fetched.config.documentDir()
+
+	if _, err := os.Stat(versionFilename(dir, versionNumber)); os.IsNotExist(err) {
+		return nil, false, nil
+	}
+
+	document, err := readVersion(key, dir, versionNumber)
+	if err != nil {
+		return nil, false, err
+	}
+
+	value, isMissingData, err := fetched.mapping.Extract(document)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return value, !isMissingData, nil
+}
+
+// UploadNew modifies the stored secret and replaces the value or sub-value
+// with a new given value, and returns the new secret version
+func (fetched *FetchedLocalSecret) UploadNew(value interface{}) (interface{}, error) {
+	key, err := fetched.config.key()
+	if err != nil {
+		return nil, err
+	}
+
+	dir := fetched.config.documentDir()
+
+	for {
+		// Get the latest secret data and version
+		version, err := latestVersion(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		var document map[string]interface{}
+
+		if version == 0 {
+			document = make(map[string]interface{})
+		} else {
+			document, err = readVersion(key, dir, version)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		// Modify the secret based on the mapping
+		document, err = fetched.mapping.Apply(document, value)
+		if err != nil {
+			return nil, err
+		}
+
+		// Write the modified secret as the next version, which fails if
+		// another writer got there first
+		written, err := writeVersion(key, dir, version+1, document)
+		if err != nil {
+			return nil, err
+		}
+
+		if written {
+			return version + 1, nil
+		}
+
+		// If there was a version conflict, then do the whole thing over again
+		util.Log.Debugf("local secret was edited during push, retrying")
+	}
+}
+
+// SecretConfig contains the configuration parameters for a secret in a local
+// encrypted secret store in secrets.yaml
+type SecretConfig struct {
+	Dir     string          `yaml:"dir"`
+	Name    string          `yaml:"name"`
+	KeyFile string          `yaml:"keyFile,omitempty"`
+	Mapping mapping.Mapping `yaml:"mapping"`
+}
+
+// Prepare validates this secret's location and loads the store's key
+func (secretConfig *SecretConfig) Prepare() error {
+	if secretConfig.Dir == "" {
+		return errors.New("no dir provided for local secret")
+	}
+
+	if secretConfig.Name == "" {
+		return errors.New("no name provided for local secret")
+	}
+
+	// Names like "..env" are fine, only ".." as a whole path element escapes
+	clean := path.Clean(secretConfig.Name)
+	if path.IsAbs(secretConfig.Name) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return fmt.Errorf("local secret name '%s' must be a relative path inside the store", secretConfig.Name)
+	}
+
+	return secretConfig.ensureKey()
+}
+
+// Describe returns the location of this secret in the local secret store
+func (secretConfig *SecretConfig) Describe() string {
+	return "local:" + filepath.ToSlash(filepath.Join(secretConfig.Dir, secretConfig.Name))
+}
+
+// Fetch decrypts the latest version of this secret and returns an instance of
+// FetchedLocalSecret
+func (secretConfig *SecretConfig) Fetch() (types.FetchedSecret, error) {
+	var secret FetchedLocalSecret
+	var err error
+
+	// Compute the format first in case of an early exit (i.e. no versions)
+	secret.format, err = secretConfig.Mapping.Format()
+	if err != nil {
+		return nil, err
+	}
+
+	secret.config = secretConfig
+	secret.mapping = secretConfig.Mapping
+
+	key, err := secretConfig.key()
+	if err != nil {
+		return nil, err
+	}
+
+	dir := secretConfig.documentDir()
+
+	secret.version, err = latestVersion(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if secret.version == 0 {
+		secret.isMissingData = true
+		return &secret, nil
+	}
+
+	document, err := readVersion(key, dir, secret.version)
+	if err != nil {
+		return nil, err
+	}
+
+	// Process secret data
+	secret.value, secret.isMissingData, err = secretConfig.Mapping.Extract(document)
+	if err != nil {
+		return nil, err
+	}
+
+	return &secret, nil
+}
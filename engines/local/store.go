@@ -0,0 +1,142 @@
+package local
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/madwire-media/secrets-cli/vars"
+)
+
+const versionExtension = ".secret"
+
+// resolvePath makes relative paths relative to the project directory instead
+// of the working directory
+func resolvePath(path string) string {
+	if filepath.IsAbs(path) || vars.ProjectDir == "" {
+		return path
+	}
+
+	return filepath.Join(vars.ProjectDir, path)
+}
+
+// documentDir returns the directory holding every version of a document
+func (secretConfig *SecretConfig) documentDir() string {
+	return filepath.Join(resolvePath(secretConfig.Dir), filepath.FromSlash(secretConfig.Name))
+}
+
+func versionFilename(dir string, version int) string {
+	return filepath.Join(dir, strconv.Itoa(version)+versionExtension)
+}
+
+// latestVersion returns the highest version of a document, or 0 if the
+// document has no versions yet
+func latestVersion(dir string) (int, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	latest := 0
+
+	for _, entry := range entries {
+		name := entry.Name()
+
+		if entry.IsDir() || !strings.HasSuffix(name, versionExtension) {
+			continue
+		}
+
+		version, err := strconv.Atoi(strings.TrimSuffix(name, versionExtension))
+		if err != nil || version <= 0 {
+			continue
+		}
+
+		if version > latest {
+			latest = version
+		}
+	}
+
+	return latest, nil
+}
+
+// readVersion reads and decrypts a particular version of a document
+func readVersion(key *[keySize]byte, dir string, version int) (map[string]interface{}, error) {
+	ciphertext, err := ioutil.ReadFile(versionFilename(dir, version))
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := decrypt(key, ciphertext)
+	if err != nil {
+		return nil, err
+	}
+
+	var document map[string]interface{}
+
+	err = json.Unmarshal(plaintext, &document)
+	if err != nil {
+		return nil, err
+	}
+
+	if document == nil {
+		document = make(map[string]interface{})
+	}
+
+	return document, nil
+}
+
+// writeVersion encrypts and writes a new version of a document. The write
+// only succeeds if the version doesn't already exist, which makes it a
+// check-and-set against the previous version. If another writer created the
+// version first then the returned bool is false
+func writeVersion(key *[keySize]byte, dir string, version int, document map[string]interface{}) (bool, error) {
+	plaintext, err := json.Marshal(document)
+	if err != nil {
+		return false, err
+	}
+
+	ciphertext, err := encrypt(key, plaintext)
+	if err != nil {
+		return false, err
+	}
+
+	err = os.MkdirAll(dir, 0770)
+	if err != nil {
+		return false, err
+	}
+
+	// Write to a temporary file first and then hard link it into place, so
+	// readers never see a partially-written version and the link fails if the
+	// version already exists
+	file, err := ioutil.TempFile(dir, ".tmp-")
+	if err != nil {
+		return false, err
+	}
+
+	defer os.Remove(file.Name())
+
+	_, err = file.Write(ciphertext)
+	if err != nil {
+		file.Close()
+		return false, err
+	}
+
+	err = file.Close()
+	if err != nil {
+		return false, err
+	}
+
+	err = os.Link(file.Name(), versionFilename(dir, version))
+	if os.IsExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
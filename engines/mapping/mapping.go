@@ -0,0 +1,113 @@
+package mapping
+
+import (
+	"errors"
+
+	"github.com/madwire-media/secrets-cli/util"
+)
+
+// Mapping represents a data or text mapping of a key/value secret document to
+// file contents
+type Mapping struct {
+	FromData *FromDataMapping `yaml:"fromData,omitempty"`
+	FromText *FromTextMapping `yaml:"fromText,omitempty"`
+}
+
+// FromDataMapping contains the settings for mapping a subset of the data of a
+// key/value secret document to file contents
+type FromDataMapping struct {
+	Format string         `yaml:"format"`
+	Path   *[]interface{} `yaml:"path,omitempty"`
+}
+
+// FromTextMapping contains the settings for mapping a string value in the data
+// of a key/value secret document to file contents
+type FromTextMapping struct {
+	Path []interface{} `yaml:"path"`
+}
+
+// Format validates this mapping and returns the format of the local file it
+// maps to
+func (mapping *Mapping) Format() (int, error) {
+	if mapping.FromData != nil {
+		switch mapping.FromData.Format {
+		case "json":
+			return util.FormatJSON, nil
+		case "yaml":
+			return util.FormatYaml, nil
+		default:
+			return util.FormatUnknown, errors.New("unknown format")
+		}
+	} else if mapping.FromText != nil {
+		if len(mapping.FromText.Path) == 0 {
+			return util.FormatUnknown, errors.New("no path provided for fromText secret mapping")
+		}
+
+		return util.FormatText, nil
+	}
+
+	return util.FormatUnknown, errors.New("no mapping provided for secret")
+}
+
+// Extract returns the mapped value out of a secret document. If the document
+// does not contain data at the mapped path then the returned bool is true
+func (mapping *Mapping) Extract(document map[string]interface{}) (interface{}, bool, error) {
+	if mapping.FromData != nil {
+		if mapping.FromData.Path == nil {
+			return document, false, nil
+		}
+
+		data, err := util.TraversePath(document, mapping.FromData.Path)
+		if err != nil {
+			if util.IsMissingData(err) {
+				return nil, true, nil
+			}
+
+			return nil, false, err
+		}
+
+		return data, false, nil
+	} else if mapping.FromText != nil {
+		data, err := util.TraversePath(document, &mapping.FromText.Path)
+		if err != nil {
+			if util.IsMissingData(err) {
+				return nil, true, nil
+			}
+
+			return nil, false, err
+		}
+
+		switch v := data.(type) {
+		case string:
+			return v, false, nil
+		default:
+			return nil, false, errors.New("Value for text mapping is not a string")
+		}
+	}
+
+	return nil, false, errors.New("no mapping provided for secret")
+}
+
+// Apply replaces the mapped value in a secret document with a new value,
+// returning the modified document
+func (mapping *Mapping) Apply(document map[string]interface{}, value interface{}) (map[string]interface{}, error) {
+	var documentAsInterface interface{} = document
+	var err error
+
+	if mapping.FromData != nil {
+		err = util.SetAtPath(&documentAsInterface, mapping.FromData.Path, value)
+	} else if mapping.FromText != nil {
+		err = util.SetAtPath(&documentAsInterface, &mapping.FromText.Path, value)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	newDocument, ok := documentAsInterface.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("mapped secret data is not an object")
+	}
+
+	return newDocument, nil
+}
@@ -1,13 +1,13 @@
 package vault
 
 import (
-	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
-	"net/http"
 	"net/url"
+	"os"
+	"strings"
 
 	jwtauth "github.com/hashicorp/vault-plugin-auth-jwt"
 	"github.com/hashicorp/vault/api"
@@ -16,7 +16,18 @@ import (
 	"github.com/madwire-media/secrets-cli/vars"
 )
 
+const (
+	defaultKubernetesJWTPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	defaultKubernetesMount   = "kubernetes"
+	defaultJWTMount          = "jwt"
+	defaultCertMount         = "cert"
+)
+
 func cacheKeyForAuth(host string, vaultAuth *types.VaultAuth) (string, bool, error) {
+	if namespace := normalizeNamespace(vaultAuth.Namespace); namespace != "" {
+		host = host + "/" + namespace
+	}
+
 	if vaultAuth.Token != nil {
 		key := fmt.Sprintf("%s,token,%s", host, *vaultAuth.Token)
 		return key, false, nil
@@ -37,6 +48,26 @@ func cacheKeyForAuth(host string, vaultAuth *types.VaultAuth) (string, bool, err
 		return key, true, nil
 	}
 
+	if vaultAuth.Kubernetes != nil {
+		key := fmt.Sprintf("%s,kubernetes,%s,%s", host, kubernetesMount(vaultAuth.Kubernetes), vaultAuth.Kubernetes.Role)
+		return key, true, nil
+	}
+
+	if vaultAuth.JWT != nil {
+		key := fmt.Sprintf("%s,jwt,%s,%s", host, jwtMount(vaultAuth.JWT), vaultAuth.JWT.Role)
+		return key, true, nil
+	}
+
+	if vaultAuth.Cert != nil {
+		var clientCert string
+		if vaultAuth.TLS != nil {
+			clientCert = vaultAuth.TLS.ClientCert
+		}
+
+		key := fmt.Sprintf("%s,cert,%s,%s,%s", host, certMount(vaultAuth.Cert), vaultAuth.Cert.Name, clientCert)
+		return key, true, nil
+	}
+
 	return "", false, errors.New("Auth config empty for host " + host)
 }
 
@@ -45,6 +76,11 @@ func ensureAuthConfiguredForURL(parsedURL *url.URL) (*string, *types.VaultAuth,
 
 	if vars.Auth.Vault != nil {
 		if config, ok := (*vars.Auth.Vault)[parsedURL.Host]; ok {
+			// Credentials in the keyring are only read for hosts that are
+			// actually used
+			config = util.LoadVaultAuthCredentials(parsedURL.Host, config)
+			(*vars.Auth.Vault)[parsedURL.Host] = config
+
 			configForHost = &config
 		}
 	}
@@ -74,6 +110,17 @@ func ensureAuthConfiguredForURL(parsedURL *url.URL) (*string, *types.VaultAuth,
 				return nil, nil, err
 			}
 
+			// Keep the TLS settings from a config without a login method
+			if configForHost != nil && configForHost.TLS != nil {
+				tlsSettings := *configForHost.TLS
+				if vaultAuth.TLS != nil {
+					tlsSettings.ClientCert = vaultAuth.TLS.ClientCert
+					tlsSettings.ClientKey = vaultAuth.TLS.ClientKey
+				}
+
+				vaultAuth.TLS = &tlsSettings
+			}
+
 			token, err := getTokenForURL(parsedURL, vaultAuth)
 			if err != nil {
 				fmt.Printf("Error, please try again: %s\n", err.Error())
@@ -102,6 +149,9 @@ func GetLoginAuthTTY() (*types.VaultAuth, error) {
 		"Userpass",
 		"AppRole",
 		"Token",
+		"Kubernetes",
+		"JWT",
+		"TLS certificate",
 	}
 
 	choiceID, err := util.CliChoice("Choose a login method", choices)
@@ -142,22 +192,74 @@ func GetLoginAuthTTY() (*types.VaultAuth, error) {
 		token := util.CliQuestion("Token")
 
 		auth.Token = &token
+
+	case 4:
+		role := util.CliQuestion("Role")
+		jwtPath := util.CliQuestion("Service account JWT path (defaults to \"" + defaultKubernetesJWTPath + "\")")
+		mount := util.CliQuestion("Kubernetes mount path (defaults to \"" + defaultKubernetesMount + "\")")
+
+		auth.Kubernetes = &types.VaultAuthKubernetes{
+			Role:    role,
+			JWTPath: jwtPath,
+			Mount:   mount,
+		}
+
+	case 5:
+		role := util.CliQuestion("Role")
+		jwtFile := util.CliQuestion("JWT file path (leave empty to read it from an environment variable)")
+
+		var jwtEnv string
+		if jwtFile == "" {
+			jwtEnv = util.CliQuestion("JWT environment variable")
+		}
+
+		mount := util.CliQuestion("JWT mount path (defaults to \"" + defaultJWTMount + "\")")
+
+		auth.JWT = &types.VaultAuthJWT{
+			Role:    role,
+			JWTFile: jwtFile,
+			JWTEnv:  jwtEnv,
+			Mount:   mount,
+		}
+
+	case 6:
+		clientCert := util.CliQuestion("Client certificate path")
+		clientKey := util.CliQuestion("Client key path")
+		name := util.CliQuestion("Certificate role name (optional)")
+		mount := util.CliQuestion("Cert mount path (defaults to \"" + defaultCertMount + "\")")
+
+		auth.TLS = &types.VaultAuthTLS{
+			ClientCert: clientCert,
+			ClientKey:  clientKey,
+		}
+		auth.Cert = &types.VaultAuthCert{
+			Name:  name,
+			Mount: mount,
+		}
 	}
 
+	auth.Namespace = util.CliQuestion("Vault Enterprise namespace (optional)")
+
 	return &auth, nil
 }
 
-func TryAuth(host string, vaultAuth *types.VaultAuth) error {
-	parsedURL := &url.URL{
-		Scheme: "https",
-		Host:   host,
+// TryAuth logs in to the Vault instance at an address from ParseAddress, and
+// makes sure the token it gets is valid
+func TryAuth(parsedURL *url.URL, vaultAuth *types.VaultAuth) error {
+	token, err := getTokenForURL(parsedURL, vaultAuth)
+	if err != nil {
+		return err
 	}
 
-	_, err := getTokenForURL(parsedURL, vaultAuth)
+	valid, err := validateToken(parsedURL, vaultAuth, token)
 	if err != nil {
 		return err
 	}
 
+	if !valid {
+		return errors.New("token is invalid or expired")
+	}
+
 	return nil
 }
 
@@ -178,30 +280,66 @@ func hasAnyAuth(vaultAuth *types.VaultAuth) bool {
 		return true
 	}
 
+	if vaultAuth.Kubernetes != nil {
+		return true
+	}
+
+	if vaultAuth.JWT != nil {
+		return true
+	}
+
+	if vaultAuth.Cert != nil {
+		return true
+	}
+
 	return false
 }
 
 func getTokenForURL(parsedURL *url.URL, vaultAuth *types.VaultAuth) (string, error) {
 	if vaultAuth.Token != nil {
+		util.Log.Debugf("using configured token for Vault instance at '%s'", parsedURL.Host)
 		return *vaultAuth.Token, nil
 	}
 
+	s := &session{
+		namespace: normalizeNamespace(vaultAuth.Namespace),
+		tls:       vaultAuth.TLS,
+	}
+
 	if vaultAuth.AppRole != nil {
-		return getTokenForURLWithAppRole(parsedURL, vaultAuth.AppRole)
+		util.Log.Debugf("logging in to Vault instance at '%s' with AppRole", parsedURL.Host)
+		return getTokenForURLWithAppRole(parsedURL, s, vaultAuth.AppRole)
 	}
 
 	if vaultAuth.Userpass != nil {
-		return getTokenForURLWithUserpass(parsedURL, vaultAuth.Userpass)
+		util.Log.Debugf("logging in to Vault instance at '%s' with userpass as '%s'", parsedURL.Host, vaultAuth.Userpass.Username)
+		return getTokenForURLWithUserpass(parsedURL, s, vaultAuth.Userpass)
 	}
 
 	if vaultAuth.OIDC != nil {
-		return getTokenForURLWithOIDC(parsedURL, vaultAuth.OIDC)
+		util.Log.Debugf("logging in to Vault instance at '%s' with OIDC", parsedURL.Host)
+		return getTokenForURLWithOIDC(parsedURL, s, vaultAuth.OIDC)
+	}
+
+	if vaultAuth.Kubernetes != nil {
+		util.Log.Debugf("logging in to Vault instance at '%s' with Kubernetes as role '%s'", parsedURL.Host, vaultAuth.Kubernetes.Role)
+		return getTokenForURLWithKubernetes(parsedURL, s, vaultAuth.Kubernetes)
+	}
+
+	if vaultAuth.JWT != nil {
+		util.Log.Debugf("logging in to Vault instance at '%s' with JWT as role '%s'", parsedURL.Host, vaultAuth.JWT.Role)
+		return getTokenForURLWithJWT(parsedURL, s, vaultAuth.JWT)
+	}
+
+	if vaultAuth.Cert != nil {
+		util.Log.Debugf("logging in to Vault instance at '%s' with a TLS certificate", parsedURL.Host)
+		return getTokenForURLWithCert(parsedURL, s, vaultAuth.Cert)
 	}
 
 	return "", errors.New("Auth config exists but is empty for " + parsedURL.Host)
 }
 
-func getTokenForURLWithUserpass(parsedURL *url.URL, userpass *types.VaultAuthUserpass) (string, error) {
+func getTokenForURLWithUserpass(parsedURL *url.URL, s *session, userpass *types.VaultAuthUserpass) (string, error) {
 	type postData struct {
 		Password string `json:"password"`
 	}
@@ -216,20 +354,46 @@ func getTokenForURLWithUserpass(parsedURL *url.URL, userpass *types.VaultAuthUse
 	loginURL.Path = "/v1/auth/userpass/login/" + userpass.Username
 	loginURL.Fragment = ""
 
-	postBytes, err := json.Marshal(postData{
+	resp, body, err := s.do("POST", loginURL.String(), postData{
 		Password: userpass.Password,
 	})
 	if err != nil {
 		return "", err
 	}
 
-	resp, err := http.Post(loginURL.String(), "application/json", bytes.NewReader(postBytes))
+	login := loginResponse{}
+	err = json.Unmarshal(body, &login)
 	if err != nil {
 		return "", err
 	}
 
-	body, err := ioutil.ReadAll(resp.Body)
-	resp.Body.Close()
+	if login.Auth.ClientToken == "" {
+		return "", errors.New("Login failed: " + resp.Status)
+	}
+
+	return login.Auth.ClientToken, nil
+}
+
+func getTokenForURLWithAppRole(parsedURL *url.URL, s *session, appRole *types.VaultAuthAppRole) (string, error) {
+	type postData struct {
+		RoleID   string `json:"role_id"`
+		SecretID string `json:"secret_id"`
+	}
+
+	type loginResponse struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+
+	loginURL := *parsedURL
+	loginURL.Path = "/v1/auth/approle/login"
+	loginURL.Fragment = ""
+
+	resp, body, err := s.do("POST", loginURL.String(), postData{
+		RoleID:   appRole.RoleID,
+		SecretID: appRole.SecretID,
+	})
 	if err != nil {
 		return "", err
 	}
@@ -247,10 +411,48 @@ func getTokenForURLWithUserpass(parsedURL *url.URL, userpass *types.VaultAuthUse
 	return login.Auth.ClientToken, nil
 }
 
-func getTokenForURLWithAppRole(parsedURL *url.URL, appRole *types.VaultAuthAppRole) (string, error) {
+func getTokenForURLWithKubernetes(parsedURL *url.URL, s *session, kubernetes *types.VaultAuthKubernetes) (string, error) {
+	jwtPath := kubernetes.JWTPath
+	if jwtPath == "" {
+		jwtPath = defaultKubernetesJWTPath
+	}
+
+	jwt, err := ioutil.ReadFile(jwtPath)
+	if err != nil {
+		return "", fmt.Errorf("could not read Kubernetes service account JWT: %w", err)
+	}
+
+	return loginWithJWT(parsedURL, s, kubernetesMount(kubernetes), kubernetes.Role, string(jwt))
+}
+
+func getTokenForURLWithJWT(parsedURL *url.URL, s *session, jwtAuth *types.VaultAuthJWT) (string, error) {
+	var jwt string
+
+	if jwtAuth.JWTFile != "" {
+		contents, err := ioutil.ReadFile(jwtAuth.JWTFile)
+		if err != nil {
+			return "", fmt.Errorf("could not read JWT: %w", err)
+		}
+
+		jwt = string(contents)
+	} else if jwtAuth.JWTEnv != "" {
+		jwt = os.Getenv(jwtAuth.JWTEnv)
+		if jwt == "" {
+			return "", fmt.Errorf("could not read JWT: environment variable %s is empty", jwtAuth.JWTEnv)
+		}
+	} else {
+		return "", errors.New("JWT auth needs a jwtFile or a jwtEnv to read the JWT from")
+	}
+
+	return loginWithJWT(parsedURL, s, jwtMount(jwtAuth), jwtAuth.Role, jwt)
+}
+
+// loginWithJWT logs in with a role and a JWT, which is how both the Kubernetes
+// and the JWT auth methods log in
+func loginWithJWT(parsedURL *url.URL, s *session, mount string, role string, jwt string) (string, error) {
 	type postData struct {
-		RoleID   string `json:"role_id"`
-		SecretID string `json:"secret_id"`
+		Role string `json:"role"`
+		JWT  string `json:"jwt"`
 	}
 
 	type loginResponse struct {
@@ -260,24 +462,60 @@ func getTokenForURLWithAppRole(parsedURL *url.URL, appRole *types.VaultAuthAppRo
 	}
 
 	loginURL := *parsedURL
-	loginURL.Path = "/v1/auth/approle/login"
+	loginURL.Path = "/v1/auth/" + mount + "/login"
 	loginURL.Fragment = ""
 
-	postBytes, err := json.Marshal(postData{
-		RoleID:   appRole.RoleID,
-		SecretID: appRole.SecretID,
+	resp, body, err := s.do("POST", loginURL.String(), postData{
+		Role: role,
+		JWT:  strings.TrimSpace(jwt),
 	})
 	if err != nil {
 		return "", err
 	}
 
-	resp, err := http.Post(loginURL.String(), "application/json", bytes.NewReader(postBytes))
+	login := loginResponse{}
+	err = json.Unmarshal(body, &login)
 	if err != nil {
 		return "", err
 	}
 
-	body, err := ioutil.ReadAll(resp.Body)
-	resp.Body.Close()
+	if login.Auth.ClientToken == "" {
+		return "", errors.New("Login failed: " + resp.Status)
+	}
+
+	return login.Auth.ClientToken, nil
+}
+
+func kubernetesMount(kubernetes *types.VaultAuthKubernetes) string {
+	if kubernetes.Mount == "" {
+		return defaultKubernetesMount
+	}
+
+	return strings.Trim(kubernetes.Mount, "/")
+}
+
+func getTokenForURLWithCert(parsedURL *url.URL, s *session, cert *types.VaultAuthCert) (string, error) {
+	type postData struct {
+		Name string `json:"name,omitempty"`
+	}
+
+	type loginResponse struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+
+	if s.tls == nil || s.tls.ClientCert == "" {
+		return "", errors.New("cert auth needs a TLS client certificate, set tls.clientCert and tls.clientKey")
+	}
+
+	loginURL := *parsedURL
+	loginURL.Path = "/v1/auth/" + certMount(cert) + "/login"
+	loginURL.Fragment = ""
+
+	resp, body, err := s.do("POST", loginURL.String(), postData{
+		Name: cert.Name,
+	})
 	if err != nil {
 		return "", err
 	}
@@ -295,7 +533,23 @@ func getTokenForURLWithAppRole(parsedURL *url.URL, appRole *types.VaultAuthAppRo
 	return login.Auth.ClientToken, nil
 }
 
-func getTokenForURLWithOIDC(parsedURL *url.URL, oidc *types.VaultAuthOIDC) (string, error) {
+func certMount(cert *types.VaultAuthCert) string {
+	if cert.Mount == "" {
+		return defaultCertMount
+	}
+
+	return strings.Trim(cert.Mount, "/")
+}
+
+func jwtMount(jwtAuth *types.VaultAuthJWT) string {
+	if jwtAuth.Mount == "" {
+		return defaultJWTMount
+	}
+
+	return strings.Trim(jwtAuth.Mount, "/")
+}
+
+func getTokenForURLWithOIDC(parsedURL *url.URL, s *session, oidc *types.VaultAuthOIDC) (string, error) {
 	if vars.IsCICD {
 		return "", errors.New("OIDC auth not supported in CI/CD mode")
 	}
@@ -303,12 +557,27 @@ func getTokenForURLWithOIDC(parsedURL *url.URL, oidc *types.VaultAuthOIDC) (stri
 	var handler jwtauth.CLIHandler
 
 	config := api.DefaultConfig()
-	config.Address = "https://" + parsedURL.Host
+	err := checkScheme(parsedURL)
+	if err != nil {
+		return "", err
+	}
+
+	config.Address = parsedURL.Scheme + "://" + parsedURL.Host
+	transport, err := transportForTLS(s.tls)
+	if err != nil {
+		return "", err
+	}
+
+	config.HttpClient.Transport = util.TraceHTTP(transport)
 	client, err := api.NewClient(config)
 	if err != nil {
 		return "", err
 	}
 
+	if s.namespace != "" {
+		client.SetNamespace(s.namespace)
+	}
+
 	settings := map[string]string{
 		"mount": oidc.Mount,
 	}
@@ -320,32 +589,3 @@ func getTokenForURLWithOIDC(parsedURL *url.URL, oidc *types.VaultAuthOIDC) (stri
 
 	return result.Auth.ClientToken, nil
 }
-
-// func renewToken(parsedURL *url.URL, token string) error {
-// 	revokeURL := *parsedURL
-// 	revokeURL.Path = "/v1/auth/token/renew-self"
-// 	revokeURL.Fragment = ""
-
-// 	req, err := http.NewRequest("POST", revokeURL.String(), nil)
-// 	if err != nil {
-// 		return err
-// 	}
-
-// 	req.Header.Add("X-Vault-Token", token)
-// 	resp, err := http.DefaultClient.Do(req)
-// 	if err != nil {
-// 		return err
-// 	}
-
-// 	respText, err := ioutil.ReadAll(resp.Body)
-// 	resp.Body.Close()
-// 	if err != nil {
-// 		return err
-// 	}
-
-// 	if resp.StatusCode != 200 {
-// 		return fmt.Errorf("could not renew token, %d status code: %s", resp.StatusCode, respText)
-// 	}
-
-// 	return nil
-// }
@@ -0,0 +1,186 @@
+package vault
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/madwire-media/secrets-cli/types"
+	"github.com/madwire-media/secrets-cli/util"
+	"github.com/madwire-media/secrets-cli/vars"
+)
+
+// tlsSettingsKey is the request context key for the TLS settings of a session
+type tlsSettingsKey struct{}
+
+var (
+	sharedClientOnce sync.Once
+	sharedClient     *http.Client
+
+	transportMutex sync.Mutex
+	transports     = make(map[types.VaultAuthTLS]http.RoundTripper)
+)
+
+// httpClient returns the HTTP client shared by every request to Vault. It's
+// created on first use so it gets traced once the log level is known
+func httpClient() *http.Client {
+	sharedClientOnce.Do(func() {
+		sharedClient = &http.Client{
+			Transport: util.TraceHTTP(tlsTransport{}),
+		}
+	})
+
+	return sharedClient
+}
+
+// tlsTransport sends each request with the TLS settings from its context, or
+// otherwise with the TLS settings in the auth config for its host
+type tlsTransport struct{}
+
+func (tlsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	err := checkScheme(req.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	settings, ok := req.Context().Value(tlsSettingsKey{}).(*types.VaultAuthTLS)
+	if !ok {
+		settings = tlsSettingsForHost(req.URL.Host)
+	}
+
+	transport, err := transportForTLS(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	return transport.RoundTrip(req)
+}
+
+// checkScheme makes sure a Vault URL uses HTTPS, or plain HTTP only when it's
+// explicitly allowed, so credentials aren't sent in plain text by accident
+func checkScheme(parsedURL *url.URL) error {
+	switch parsedURL.Scheme {
+	case "https":
+		return nil
+	case "http":
+		if vars.AllowHTTP {
+			return nil
+		}
+
+		return fmt.Errorf("refusing to connect to Vault instance at '%s' over plain HTTP, use the --allow-http flag for local development", parsedURL.Host)
+	default:
+		return fmt.Errorf("unsupported scheme '%s' for Vault instance at '%s'", parsedURL.Scheme, parsedURL.Host)
+	}
+}
+
+// ParseAddress parses the address of a Vault instance, which is either a host
+// for HTTPS or a URL to keep its scheme, into a URL with only a scheme and host
+func ParseAddress(address string) (*url.URL, error) {
+	parsedURL := &url.URL{
+		Scheme: "https",
+		Host:   address,
+	}
+
+	if strings.Contains(address, "://") {
+		addressURL, err := url.Parse(address)
+		if err != nil {
+			return nil, err
+		} else if addressURL.Host == "" {
+			return nil, fmt.Errorf("invalid Vault address '%s'", address)
+		}
+
+		parsedURL.Scheme = addressURL.Scheme
+		parsedURL.Host = addressURL.Host
+	}
+
+	err := checkScheme(parsedURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return parsedURL, nil
+}
+
+func tlsSettingsForHost(host string) *types.VaultAuthTLS {
+	if vars.Auth.Vault != nil {
+		if vaultAuth, ok := (*vars.Auth.Vault)[host]; ok {
+			return vaultAuth.TLS
+		}
+	}
+
+	return nil
+}
+
+// transportForTLS returns a transport configured with some TLS settings,
+// reusing the same transport for the same settings so connections are kept
+// alive between requests
+func transportForTLS(settings *types.VaultAuthTLS) (http.RoundTripper, error) {
+	if settings == nil {
+		return http.DefaultTransport, nil
+	}
+
+	transportMutex.Lock()
+	defer transportMutex.Unlock()
+
+	if transport, ok := transports[*settings]; ok {
+		return transport, nil
+	}
+
+	tlsConfig, err := newTLSConfig(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	if settings.InsecureSkipVerify {
+		util.Log.Warnf("TLS certificate verification is disabled for a Vault instance, only do this for local development")
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	transports[*settings] = transport
+
+	return transport, nil
+}
+
+func newTLSConfig(settings *types.VaultAuthTLS) (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         settings.ServerName,
+		InsecureSkipVerify: settings.InsecureSkipVerify,
+	}
+
+	if settings.CAFile != "" {
+		pem, err := ioutil.ReadFile(settings.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read CA file: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file '%s'", settings.CAFile)
+		}
+
+		config.RootCAs = pool
+	}
+
+	if settings.ClientCert != "" || settings.ClientKey != "" {
+		if settings.ClientCert == "" || settings.ClientKey == "" {
+			return nil, errors.New("TLS client certificate needs both clientCert and clientKey")
+		}
+
+		cert, err := tls.LoadX509KeyPair(settings.ClientCert, settings.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("could not load TLS client certificate: %w", err)
+		}
+
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
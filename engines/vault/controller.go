@@ -2,11 +2,12 @@ package vault
 
 import (
 	"errors"
-	"io/ioutil"
 	"net/http"
 	"net/url"
+	"sync"
 	"time"
 
+	"github.com/madwire-media/secrets-cli/types"
 	"github.com/madwire-media/secrets-cli/util"
 	"github.com/madwire-media/secrets-cli/vars"
 )
@@ -14,18 +15,31 @@ import (
 var auth vaultController
 
 type vaultController struct {
+	mutex           sync.Mutex
 	init            bool
 	config          vaultConfig
 	validatedTokens map[string]struct{}
+	storedTokens    map[string]storedToken
+}
+
+// storedToken is a cached token that was saved in the keyring, along with the
+// reference to it that's saved in the vault user config instead
+type storedToken struct {
+	token string
+	ref   string
 }
 
 type vaultConfig struct {
 	TokenCache map[string]cachedToken `json:"tokenCache"`
 }
 
+// cachedToken is a token saved in the vault user config. Expires and
+// RenewAfter are unix timestamps, and are 0 for tokens that never expire
 type cachedToken struct {
-	Token   string `json:"token"`
-	Expires int64  `json:"expires"`
+	Token      string `json:"token"`
+	Expires    int64  `json:"expires"`
+	RenewAfter int64  `json:"renewAfter,omitempty"`
+	Renewable  bool   `json:"renewable,omitempty"`
 }
 
 func (controller *vaultController) Init() error {
@@ -33,26 +47,40 @@ func (controller *vaultController) Init() error {
 		return nil
 	}
 
-	config := vaultConfig{
+	controller.config = vaultConfig{
 		TokenCache: make(map[string]cachedToken),
 	}
+	controller.validatedTokens = make(map[string]struct{})
+	controller.storedTokens = make(map[string]storedToken)
 
 	if !vars.IsCICD {
-		err := util.LoadConfig("vault", &config)
+		err := util.LoadConfig("vault", &controller.config)
 		if err != nil {
 			return err
 		}
 
-		if config.TokenCache == nil {
-			config.TokenCache = make(map[string]cachedToken)
+		if controller.config.TokenCache == nil {
+			controller.config.TokenCache = make(map[string]cachedToken)
 		}
 
 		needToSave := false
 		now := time.Now().Unix()
 
-		for key, cached := range config.TokenCache {
-			if cached.Expires < now {
-				delete(config.TokenCache, key)
+		for key, cached := range controller.config.TokenCache {
+			if cached.Expires != 0 && cached.Expires < now {
+				// Expired tokens are only remembered so their keyring entry
+				// gets deleted when saving
+				controller.storedTokens[key] = storedToken{ref: cached.Token}
+				delete(controller.config.TokenCache, key)
+				needToSave = true
+				continue
+			}
+
+			if util.IsCredentialRef(cached.Token) {
+				// Tokens in the keyring are only read once they're used
+				controller.storedTokens[key] = storedToken{ref: cached.Token}
+			} else if util.KeyringAvailable() {
+				// Move tokens cached by older versions into the keyring
 				needToSave = true
 			}
 		}
@@ -66,19 +94,22 @@ func (controller *vaultController) Init() error {
 	}
 
 	controller.init = true
-	controller.config = config
-	controller.validatedTokens = make(map[string]struct{})
 
 	return nil
 }
 
 func (controller *vaultController) PrepareForURL(parsedURL *url.URL) error {
+	controller.mutex.Lock()
+	defer controller.mutex.Unlock()
+
 	err := controller.Init()
 	if err != nil {
 		return err
 	}
 
+	util.PromptMutex.Lock()
 	optToken, vaultAuth, err := ensureAuthConfiguredForURL(parsedURL)
+	util.PromptMutex.Unlock()
 	if err != nil {
 		return err
 	}
@@ -92,11 +123,8 @@ func (controller *vaultController) PrepareForURL(parsedURL *url.URL) error {
 		controller.validatedTokens[key] = struct{}{}
 
 		if shouldCache {
-			cached := cachedToken{
-				Token:   *optToken,
-				Expires: time.Now().Unix() + 32*24*60*60,
-			}
-			controller.config.TokenCache[key] = cached
+			namespace := normalizeNamespace(vaultAuth.Namespace)
+			controller.config.TokenCache[key] = lookupToken(parsedURL, namespace, *optToken)
 
 			err := controller.save()
 			if err != nil {
@@ -108,7 +136,13 @@ func (controller *vaultController) PrepareForURL(parsedURL *url.URL) error {
 	return nil
 }
 
+// GetTokenForURL returns a valid token for the host of a URL, validating cached
+// tokens by looking them up. Only invalid tokens are thrown away, so a token
+// without access to a secret still gets used and fails with a permission error
 func (controller *vaultController) GetTokenForURL(parsedURL *url.URL) (string, error) {
+	controller.mutex.Lock()
+	defer controller.mutex.Unlock()
+
 	vaultAuth, ok := (*vars.Auth.Vault)[parsedURL.Host]
 
 	if !ok {
@@ -120,34 +154,54 @@ func (controller *vaultController) GetTokenForURL(parsedURL *url.URL) (string, e
 		return "", err
 	}
 
-	if cached, ok := controller.config.TokenCache[key]; ok {
+	authNamespace := normalizeNamespace(vaultAuth.Namespace)
+
+	if cached, ok := controller.loadCachedToken(key); ok {
 		if _, ok = controller.validatedTokens[key]; ok {
 			return cached.Token, nil
 		}
 
-		valid := validateTokenForURL(parsedURL, cached.Token)
-		if valid {
-			controller.validatedTokens[key] = struct{}{}
+		if cached.Renewable && cached.needsRenewal(time.Now().Unix()) {
+			renewed, err := renewToken(parsedURL, authNamespace, cached.Token)
+			if err == nil {
+				util.Log.Debugf("renewed cached token for Vault instance at '%s'", parsedURL.Host)
+
+				controller.config.TokenCache[key] = renewed
+				controller.validatedTokens[key] = struct{}{}
+
+				err = controller.save()
+				if err != nil {
+					return "", err
+				}
 
-			// Tokens don't renew on their own, and even when they're renewed,
-			// they can only last a certain maximum lifetime. The default for
-			// this is 768h or 32d. In this case though, we're just validating
-			// an existing token so it's (with default settings) guaranteed that
-			// even if we renewed this token it wouldn't help anything.
+				return renewed.Token, nil
+			}
 
-			// cached.Expires = time.Now().UTC().Unix() + 32*24*60*60
-			// err := controller.save()
-			// if err != nil {
-			// 	return "", err
-			// }
+			// The token may still be valid until it expires, and if it isn't
+			// then it fails validation below anyway
+			util.Log.Debugf("failed to renew cached token for Vault instance at '%s': %s", parsedURL.Host, err)
+		}
+
+		valid, err := validateToken(parsedURL, &vaultAuth, cached.Token)
+		if err != nil {
+			return "", err
+		}
+
+		if valid {
+			util.Log.Debugf("using cached token for Vault instance at '%s'", parsedURL.Host)
+
+			controller.validatedTokens[key] = struct{}{}
 
 			return cached.Token, nil
 		}
 
+		util.Log.Debugf("cached token for Vault instance at '%s' is no longer valid", parsedURL.Host)
 		delete(controller.config.TokenCache, key)
 	}
 
+	util.PromptMutex.Lock()
 	token, err := getTokenForURL(parsedURL, &vaultAuth)
+	util.PromptMutex.Unlock()
 	if err != nil {
 		return "", err
 	}
@@ -155,12 +209,7 @@ func (controller *vaultController) GetTokenForURL(parsedURL *url.URL) (string, e
 	controller.validatedTokens[key] = struct{}{}
 
 	if shouldCache {
-		cached := cachedToken{
-			Token:   token,
-			Expires: time.Now().UTC().Unix() + 32*24*60*60,
-		}
-
-		controller.config.TokenCache[key] = cached
+		controller.config.TokenCache[key] = lookupToken(parsedURL, authNamespace, token)
 
 		err = controller.save()
 		if err != nil {
@@ -171,31 +220,154 @@ func (controller *vaultController) GetTokenForURL(parsedURL *url.URL) (string, e
 	return token, nil
 }
 
+// loadCachedToken gets a cached token, reading it from the keyring the first
+// time it's used. A token that can't be read is dropped from the cache, since
+// logging in again gets a new one
+func (controller *vaultController) loadCachedToken(key string) (cachedToken, bool) {
+	cached, ok := controller.config.TokenCache[key]
+	if !ok || !util.IsCredentialRef(cached.Token) {
+		return cached, ok
+	}
+
+	token, err := util.LoadCredential(cached.Token)
+	if err != nil {
+		util.Log.Debugf("dropping cached token: %s", err)
+		delete(controller.config.TokenCache, key)
+		return cached, false
+	}
+
+	controller.storedTokens[key] = storedToken{
+		token: token,
+		ref:   cached.Token,
+	}
+
+	cached.Token = token
+	controller.config.TokenCache[key] = cached
+
+	return cached, true
+}
+
 func (controller *vaultController) save() error {
 	if vars.IsCICD {
 		return nil
 	}
 
-	return util.SaveConfig("vault", &controller.config)
-}
+	config := vaultConfig{
+		TokenCache: make(map[string]cachedToken),
+	}
+
+	for key, cached := range controller.config.TokenCache {
+		if util.IsCredentialRef(cached.Token) {
+			// The token hasn't been read from the keyring yet
+			config.TokenCache[key] = cached
+			continue
+		}
+
+		stored, ok := controller.storedTokens[key]
+
+		if !ok || stored.token != cached.Token {
+			ref, err := util.StoreCredential("vault/tokenCache/"+key, cached.Token)
+			if err != nil {
+				return err
+			}
+
+			stored = storedToken{
+				token: cached.Token,
+				ref:   ref,
+			}
+
+			controller.storedTokens[key] = stored
+		}
+
+		cached.Token = stored.ref
+		config.TokenCache[key] = cached
+	}
 
-func validateTokenForURL(parsedURL *url.URL, token string) bool {
-	req, err := http.NewRequest("GET", parsedURL.String(), nil)
+	err := util.SaveConfig("vault", &config)
 	if err != nil {
-		return false
+		return err
+	}
+
+	for key, stored := range controller.storedTokens {
+		if _, ok := controller.config.TokenCache[key]; !ok {
+			err = util.DeleteCredential(stored.ref)
+			if err != nil {
+				util.Log.Warnf("%s", err)
+			}
+
+			delete(controller.storedTokens, key)
+		}
+	}
+
+	return nil
+}
+
+// namespaceForSecret returns the namespace to make requests for a secret in,
+// which is the secret's own namespace if it has one, or otherwise the namespace
+// the host's auth config logs in to
+func namespaceForSecret(parsedURL *url.URL, secretNamespace string) string {
+	if namespace := normalizeNamespace(secretNamespace); namespace != "" {
+		return namespace
+	}
+
+	if vars.Auth.Vault != nil {
+		if vaultAuth, ok := (*vars.Auth.Vault)[parsedURL.Host]; ok {
+			return normalizeNamespace(vaultAuth.Namespace)
+		}
 	}
 
-	req.Header.Add("Authorization", "Bearer "+token)
-	resp, err := http.DefaultClient.Do(req)
+	return ""
+}
+
+// validateToken checks if a token is valid by looking it up on the host of a
+// URL, in the namespace of the auth config it was issued for. A 401 means the
+// token is invalid or expired, but a 403 may only mean the token's policies
+// don't allow looking itself up, like when it doesn't have the default policy.
+// Any other failure is returned as an error so a valid token isn't thrown away
+// because of it
+func validateToken(parsedURL *url.URL, vaultAuth *types.VaultAuth, token string) (bool, error) {
+	s := &session{
+		token:     token,
+		namespace: normalizeNamespace(vaultAuth.Namespace),
+		tls:       vaultAuth.TLS,
+	}
+
+	resp, body, err := s.do("GET", lookupSelfURL(parsedURL).String(), nil)
 	if err != nil {
-		return false
+		return false, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusUnauthorized:
+		return false, nil
+	case http.StatusForbidden:
+		if !isTokenDenied(body) {
+			return true, nil
+		}
+
+		// Vault denies invalid tokens and tokens without the policy for it the
+		// same way, so the token is only invalid if it can't read anything
+		// else either. If it can, the secret request reports the real error
+		return canReadMount(s, parsedURL)
+	default:
+		return false, errors.New("Got status " + resp.Status + " while validating token")
 	}
+}
 
-	_, err = ioutil.ReadAll(resp.Body)
-	resp.Body.Close()
+// canReadMount checks if a session's token can read the mount a secret URL
+// belongs to, which any valid token with access to the secret can
+func canReadMount(s *session, secretURL *url.URL) (bool, error) {
+	resp, _, err := s.do("GET", mountsURL(secretURL).String(), nil)
 	if err != nil {
-		return false
+		return false, err
 	}
 
-	return resp.StatusCode == 200
+	switch resp.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return false, nil
+	default:
+		return true, nil
+	}
 }
@@ -0,0 +1,61 @@
+package vault
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/madwire-media/secrets-cli/types"
+	"github.com/madwire-media/secrets-cli/vars"
+)
+
+func TestValidateToken(t *testing.T) {
+	tests := []struct {
+		name         string
+		lookupStatus int
+		lookupBody   string
+		mountStatus  int
+		valid        bool
+	}{
+		{"valid", http.StatusOK, `{"data":{}}`, http.StatusOK, true},
+		{"unauthorized", http.StatusUnauthorized, `{"errors":["missing client token"]}`, http.StatusOK, false},
+		{"invalid token", http.StatusForbidden, `{"errors":["permission denied"]}`, http.StatusForbidden, false},
+		{"without default policy", http.StatusForbidden, `{"errors":["1 error occurred:\n\t* permission denied\n\n"]}`, http.StatusOK, true},
+		{"other forbidden error", http.StatusForbidden, `{"errors":["request originated from invalid CIDR"]}`, http.StatusForbidden, true},
+	}
+
+	vars.AllowHTTP = true
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/v1/auth/token/lookup-self":
+					w.WriteHeader(test.lookupStatus)
+					w.Write([]byte(test.lookupBody))
+				case "/v1/sys/internal/ui/mounts/kv/app":
+					w.WriteHeader(test.mountStatus)
+					w.Write([]byte(`{"errors":["permission denied"]}`))
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			defer server.Close()
+
+			parsedURL, err := url.Parse(server.URL + "/kv/app")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			valid, err := validateToken(parsedURL, &types.VaultAuth{}, "token")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if valid != test.valid {
+				t.Errorf("expected valid to be %v, got %v", test.valid, valid)
+			}
+		})
+	}
+}
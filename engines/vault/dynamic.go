@@ -0,0 +1,155 @@
+package vault
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/madwire-media/secrets-cli/types"
+)
+
+// DynamicConfig contains the settings for reading a dynamic secret from a
+// non-K/V Vault secrets engine, like database/creds/<role> or pki/issue/<role>
+type DynamicConfig struct {
+	Method      string                 `yaml:"method,omitempty"`
+	Params      map[string]interface{} `yaml:"params,omitempty"`
+	RenewBefore string                 `yaml:"renewBefore,omitempty"`
+}
+
+type dynamicResponse struct {
+	LeaseID       string                 `json:"lease_id"`
+	LeaseDuration int64                  `json:"lease_duration"`
+	Renewable     bool                   `json:"renewable"`
+	Data          map[string]interface{} `json:"data"`
+}
+
+// method returns the HTTP method used to issue the secret, defaulting to GET
+// unless there are parameters to send
+func (dynamic *DynamicConfig) method() (string, error) {
+	method := strings.ToUpper(dynamic.Method)
+
+	switch method {
+	case "":
+		if len(dynamic.Params) > 0 {
+			return "POST", nil
+		}
+
+		return "GET", nil
+
+	case "GET", "POST", "PUT":
+		return method, nil
+
+	default:
+		return "", fmt.Errorf("unsupported method '%s' for dynamic secret", dynamic.Method)
+	}
+}
+
+// renewBefore returns how long before a lease expires the secret should be
+// issued again, defaulting to a third of the lease duration
+func (dynamic *DynamicConfig) renewBefore(leaseDuration time.Duration) (time.Duration, error) {
+	if dynamic.RenewBefore == "" {
+		return leaseDuration / 3, nil
+	}
+
+	duration, err := time.ParseDuration(dynamic.RenewBefore)
+	if err != nil {
+		return 0, fmt.Errorf("invalid renewBefore for dynamic secret: %s", err.Error())
+	}
+
+	return duration, nil
+}
+
+// dynamicAPIURL converts a secret URL into the API URL for issuing it
+func dynamicAPIURL(secretURL *url.URL) *url.URL {
+	apiURL := *secretURL
+	apiURL.Path = "/v1/" + strings.Trim(secretURL.Path, "/")
+
+	return &apiURL
+}
+
+// issueDynamic issues a new dynamic secret, returning its data and lease
+func issueDynamic(s *session, apiURL *url.URL, dynamic *DynamicConfig) (map[string]interface{}, *types.Lease, error) {
+	method, err := dynamic.method()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var body interface{}
+	if method != "GET" {
+		body = dynamic.Params
+	}
+
+	resp, respBody, err := s.do(method, apiURL.String(), body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if resp.StatusCode != 200 {
+		return nil, nil, statusError(resp, "issuing dynamic secret")
+	}
+
+	issued := dynamicResponse{}
+	err = json.Unmarshal(respBody, &issued)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if issued.Data == nil {
+		return nil, nil, errors.New("dynamic secret response has no data")
+	}
+
+	now := time.Now()
+	lease := types.Lease{
+		ID: issued.LeaseID,
+	}
+
+	var expires time.Time
+
+	if issued.LeaseDuration > 0 {
+		expires = now.Add(time.Duration(issued.LeaseDuration) * time.Second)
+	} else if expiration, ok := issued.Data["expiration"].(float64); ok && expiration > 0 {
+		// Certificates from the PKI engine aren't leased by default, but they
+		// still have an expiration time
+		expires = time.Unix(int64(expiration), 0)
+	}
+
+	if !expires.IsZero() {
+		renewBefore, err := dynamic.renewBefore(expires.Sub(now))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		lease.Expires = expires.Unix()
+		lease.RenewAfter = expires.Add(-renewBefore).Unix()
+	}
+
+	return issued.Data, &lease, nil
+}
+
+// dynamicVersion returns the version tracked for an issued dynamic secret,
+// which is its lease ID. Endpoints like pki/issue don't lease what they issue,
+// so the certificate's serial number is used instead, or otherwise a hash of
+// the issued data
+func dynamicVersion(data map[string]interface{}, lease *types.Lease) (string, error) {
+	if lease.ID != "" {
+		return lease.ID, nil
+	}
+
+	if serial, ok := data["serial_number"].(string); ok && serial != "" {
+		return "serial:" + serial, nil
+	}
+
+	asJSON, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+
+	digest := sha256.Sum256(asJSON)
+
+	return "sha256:" + hex.EncodeToString(digest[:]), nil
+}
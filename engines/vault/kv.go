@@ -0,0 +1,349 @@
+package vault
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+const (
+	casMismatch = "check-and-set parameter did not match the current version"
+
+	// kvV1VersionPrefix marks a pseudo-version computed from the contents of a
+	// K/V v1 secret, since K/V v1 has no versioning of its own
+	kvV1VersionPrefix = "sha256:"
+)
+
+type rawSecretV1 struct {
+	Data map[string]interface{} `json:"data"`
+}
+
+type rawSecret struct {
+	Data struct {
+		Data     map[string]interface{} `json:"data"`
+		Metadata struct {
+			CreatedTime  string `json:"created_time"`
+			DeletionTime string `json:"deletion_time"`
+			Destroyed    bool   `json:"destroyed"`
+			Version      int    `json:"version"`
+		} `json:"metadata"`
+	} `json:"data"`
+}
+
+// kvDocument is a K/V secret document along with its version. For K/V v2 the
+// version is an int, and for K/V v1 it's a hash of the document
+type kvDocument struct {
+	data    map[string]interface{}
+	version interface{}
+}
+
+// kvMount is the mount point of a K/V secrets engine
+type kvMount struct {
+	path      string
+	kvVersion int
+}
+
+// documentFetch is a single fetch of a K/V secret document, shared by every
+// secret that maps data out of the same document
+type documentFetch struct {
+	done     chan struct{}
+	document *kvDocument
+	err      error
+}
+
+var (
+	discoveredMounts      = make(map[string]*kvMount)
+	discoveredMountsMutex sync.Mutex
+
+	documentFetches      = make(map[string]*documentFetch)
+	documentFetchesMutex sync.Mutex
+)
+
+// splitMount splits a secret URL path into the path of its K/V mount and the
+// path of the secret within the mount, assuming the mount is the given path or
+// the first path segment if the given mount path is empty
+func splitMount(secretPath string, mountPath string) (string, string, error) {
+	secretPath = strings.Trim(secretPath, "/")
+	mountPath = strings.Trim(mountPath, "/")
+
+	if mountPath == "" {
+		idx := strings.IndexRune(secretPath, '/')
+		if idx == -1 {
+			return "", "", errors.New("URL has only one path segment")
+		}
+
+		return secretPath[:idx], secretPath[idx+1:], nil
+	}
+
+	if !strings.HasPrefix(secretPath, mountPath+"/") {
+		return "", "", fmt.Errorf("secret path '%s' is not inside mount '%s'", secretPath, mountPath)
+	}
+
+	return mountPath, secretPath[len(mountPath)+1:], nil
+}
+
+// discoverMount asks Vault which mount a secret URL belongs to. If Vault
+// doesn't support mount discovery or the token isn't allowed to use it, nil is
+// returned instead of an error
+func discoverMount(s *session, secretURL *url.URL) (*kvMount, error) {
+	type mountResponse struct {
+		Data struct {
+			Path    string `json:"path"`
+			Type    string `json:"type"`
+			Options struct {
+				Version string `json:"version"`
+			} `json:"options"`
+		} `json:"data"`
+	}
+
+	cacheKey := s.namespace + "@" + secretURL.Host + secretURL.Path
+	discoveredMountsMutex.Lock()
+	mount, ok := discoveredMounts[cacheKey]
+	discoveredMountsMutex.Unlock()
+
+	if ok {
+		return mount, nil
+	}
+
+	resp, body, err := s.do("GET", mountsURL(secretURL).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == 200 {
+		mountData := mountResponse{}
+		err = json.Unmarshal(body, &mountData)
+		if err != nil {
+			return nil, err
+		}
+
+		if mountData.Data.Path != "" {
+			if mountData.Data.Type != "kv" && mountData.Data.Type != "generic" {
+				return nil, fmt.Errorf("Vault mount '%s' is a '%s' secrets engine, not a K/V secrets engine", mountData.Data.Path, mountData.Data.Type)
+			}
+
+			mount = &kvMount{
+				path:      strings.Trim(mountData.Data.Path, "/"),
+				kvVersion: 1,
+			}
+
+			if mountData.Data.Options.Version == "2" {
+				mount.kvVersion = 2
+			}
+		}
+	}
+
+	discoveredMountsMutex.Lock()
+	discoveredMounts[cacheKey] = mount
+	discoveredMountsMutex.Unlock()
+
+	return mount, nil
+}
+
+// mountsURL returns the URL of the endpoint describing the mount a secret URL
+// belongs to
+func mountsURL(secretURL *url.URL) *url.URL {
+	apiURL := *secretURL
+	apiURL.Path = "/v1/sys/internal/ui/mounts/" + strings.Trim(secretURL.Path, "/")
+	apiURL.RawQuery = ""
+	apiURL.Fragment = ""
+
+	return &apiURL
+}
+
+// kvAPIURL converts a secret URL into the API URL for reading and writing the
+// secret's data
+func kvAPIURL(secretURL *url.URL, mountPath string, kvVersion int) (*url.URL, error) {
+	apiURL := *secretURL
+
+	mountPath, secretPath, err := splitMount(secretURL.Path, mountPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if kvVersion == 1 {
+		apiURL.Path = "/v1/" + mountPath + "/" + secretPath
+	} else {
+		// Insert /data into the secret path after the secrets engine mount
+		apiURL.Path = "/v1/" + mountPath + "/data/" + secretPath
+	}
+
+	return &apiURL, nil
+}
+
+// readKV reads a K/V secret document, returning nil if it doesn't exist
+func readKV(s *session, apiURL *url.URL, kvVersion int) (*kvDocument, error) {
+	resp, body, err := s.do("GET", apiURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == 404 {
+		return nil, nil
+	} else if resp.StatusCode != 200 {
+		return nil, statusError(resp, "fetching secret")
+	}
+
+	if kvVersion == 1 {
+		rawSecretData := rawSecretV1{}
+		err = json.Unmarshal(body, &rawSecretData)
+		if err != nil {
+			return nil, err
+		}
+
+		return makeKVV1Document(rawSecretData.Data)
+	}
+
+	rawSecretData := rawSecret{}
+	err = json.Unmarshal(body, &rawSecretData)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kvDocument{
+		data:    rawSecretData.Data.Data,
+		version: rawSecretData.Data.Metadata.Version,
+	}, nil
+}
+
+// readKVOnce reads a K/V secret document like readKV, but only fetches every
+// document once until it's written, sharing the result with every other secret
+// in the same document. The shared document must not be modified
+func readKVOnce(s *session, apiURL *url.URL, kvVersion int) (*kvDocument, error) {
+	cacheKey := s.namespace + "@" + apiURL.String()
+
+	documentFetchesMutex.Lock()
+	fetch, fetching := documentFetches[cacheKey]
+	if !fetching {
+		fetch = &documentFetch{
+			done: make(chan struct{}),
+		}
+		documentFetches[cacheKey] = fetch
+	}
+	documentFetchesMutex.Unlock()
+
+	if fetching {
+		<-fetch.done
+	} else {
+		fetch.document, fetch.err = readKV(s, apiURL, kvVersion)
+		close(fetch.done)
+	}
+
+	return fetch.document, fetch.err
+}
+
+// forgetKV drops a K/V secret document fetched by readKVOnce after it's been
+// written, so fetching it again doesn't return the old data
+func forgetKV(s *session, apiURL *url.URL) {
+	cacheKey := s.namespace + "@" + apiURL.String()
+
+	documentFetchesMutex.Lock()
+	delete(documentFetches, cacheKey)
+	documentFetchesMutex.Unlock()
+}
+
+// writeKV writes a new K/V secret document. For K/V v2 the write is a
+// check-and-set against the given previous document's version, and the
+// returned bool is false if the check-and-set failed. K/V v1 does not support
+// check-and-set, so the write always succeeds
+func writeKV(s *session, apiURL *url.URL, kvVersion int, previous *kvDocument, data map[string]interface{}) (interface{}, bool, error) {
+	type secretPost struct {
+		Options struct {
+			CAS *int `json:"cas"`
+		} `json:"options"`
+		Data map[string]interface{} `json:"data"`
+	}
+
+	type okResponse struct {
+		Data struct {
+			Version int `json:"version"`
+		} `json:"data"`
+	}
+
+	type errorResponse struct {
+		Data struct {
+			Error string `json:"error"`
+		} `json:"data"`
+	}
+
+	if kvVersion == 1 {
+		resp, _, err := s.do("POST", apiURL.String(), data)
+		if err != nil {
+			return nil, false, err
+		}
+
+		if resp.StatusCode != 200 && resp.StatusCode != 204 {
+			return nil, false, statusError(resp, "setting secret")
+		}
+
+		// The version is a hash of the data that Vault stored, which isn't
+		// necessarily encoded the same as the data that was sent, so it's read
+		// back to get the same version the next fetch will
+		document, err := readKV(s, apiURL, kvVersion)
+		if err != nil {
+			return nil, false, err
+		} else if document == nil {
+			return nil, false, errors.New("secret is missing after setting it")
+		}
+
+		return document.version, true, nil
+	}
+
+	cas := 0
+	if previous != nil {
+		cas = previous.version.(int)
+	}
+
+	var postData secretPost
+
+	postData.Options.CAS = &cas
+	postData.Data = data
+
+	resp, body, err := s.do("POST", apiURL.String(), postData)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if resp.StatusCode == 200 {
+		// check-and-set succeeded, data was written, return the new version
+
+		okData := okResponse{}
+		err = json.Unmarshal(body, &okData)
+		if err != nil {
+			return nil, false, err
+		}
+
+		return okData.Data.Version, true, nil
+	}
+
+	errorData := errorResponse{}
+	err = json.Unmarshal(body, &errorData)
+	if err != nil {
+		return nil, false, statusError(resp, "setting secret")
+	}
+
+	if errorData.Data.Error != casMismatch {
+		return nil, false, statusError(resp, "setting secret")
+	}
+
+	return nil, false, nil
+}
+
+func makeKVV1Document(data map[string]interface{}) (*kvDocument, error) {
+	asJSON, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := sha256.Sum256(asJSON)
+
+	return &kvDocument{
+		data:    data,
+		version: kvV1VersionPrefix + hex.EncodeToString(digest[:]),
+	}, nil
+}
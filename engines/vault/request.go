@@ -0,0 +1,117 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/madwire-media/secrets-cli/types"
+	"github.com/madwire-media/secrets-cli/util"
+)
+
+// session holds everything needed to make authenticated requests to Vault. If
+// tls is nil then the TLS settings in the auth config for the host are used
+type session struct {
+	token     string
+	namespace string
+	tls       *types.VaultAuthTLS
+}
+
+// do sends a request to Vault with this session's token and namespace,
+// encoding the given body as JSON if it isn't nil, and returns the response
+// and its body
+func (s *session) do(method string, url string, body interface{}) (*http.Response, []byte, error) {
+	var reader io.Reader
+
+	if body != nil {
+		bodyBytes, err := json.Marshal(body)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		reader = bytes.NewReader(bodyBytes)
+	}
+
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if s.token != "" {
+		req.Header.Add("Authorization", "Bearer "+s.token)
+	}
+
+	if s.namespace != "" {
+		req.Header.Add("X-Vault-Namespace", s.namespace)
+	}
+
+	if body != nil {
+		req.Header.Add("Content-Type", "application/json")
+	}
+
+	if s.tls != nil {
+		req = req.WithContext(context.WithValue(req.Context(), tlsSettingsKey{}, s.tls))
+	}
+
+	resp, err := httpClient().Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if resp.StatusCode >= 400 {
+		util.Log.Debugf("Vault returned %s for %s %s%s", resp.Status, method, req.URL.Redacted(), responseErrors(respBody))
+	}
+
+	return resp, respBody, nil
+}
+
+// responseErrors formats the error messages in a Vault error response for
+// logging. Only the "errors" array is used, since a proxy or a misbehaving
+// endpoint could send back anything in the rest of the body
+func responseErrors(body []byte) string {
+	var errorResponse struct {
+		Errors []string `json:"errors"`
+	}
+
+	err := json.Unmarshal(body, &errorResponse)
+	if err != nil || len(errorResponse.Errors) == 0 {
+		return ""
+	}
+
+	return ": " + strings.Join(errorResponse.Errors, "; ")
+}
+
+// isTokenDenied returns true if an error response says the token was invalid
+// or denied
+func isTokenDenied(body []byte) bool {
+	message := strings.ToLower(responseErrors(body))
+
+	return strings.Contains(message, "invalid token") || strings.Contains(message, "permission denied")
+}
+
+// statusError builds the error for an unexpected response status while doing
+// an action. Tokens are validated before they're used, so a 403 means the
+// token is valid but its policies don't allow the action
+func statusError(resp *http.Response, action string) error {
+	if resp.StatusCode == http.StatusForbidden {
+		return errors.New("Permission denied for '" + resp.Request.URL.Path + "' while " + action + ", the token's policies don't allow it")
+	}
+
+	return errors.New("Got status " + resp.Status + " while " + action)
+}
+
+// normalizeNamespace trims the slashes around a namespace path
+func normalizeNamespace(namespace string) string {
+	return strings.Trim(namespace, "/")
+}
@@ -1,33 +1,38 @@
 package vault
 
 import (
-	"bytes"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
-	"net/http"
 	"net/url"
-	"strings"
+	"strconv"
 
+	"github.com/madwire-media/secrets-cli/engines"
+	"github.com/madwire-media/secrets-cli/engines/mapping"
 	"github.com/madwire-media/secrets-cli/types"
 	"github.com/madwire-media/secrets-cli/util"
 )
 
-const (
-	casMismatch = "check-and-set parameter did not match the current version"
-)
+func init() {
+	engines.Register("vault", func() engines.Engine {
+		return &SecretConfig{}
+	})
+}
 
 // FetchedVaultSecret is an implementation of types.FetchedSecret specifically
 // for a secret fetched from Vault
 type FetchedVaultSecret struct {
 	value         interface{}
-	version       int
+	version       interface{}
 	format        int
 	isMissingData bool
 
-	apiURL  *url.URL
-	mapping Mapping
+	secretURL *url.URL
+	apiURL    *url.URL
+	namespace string
+	kvVersion int
+	mapping   mapping.Mapping
+	transit   *TransitConfig
+	lease     *types.Lease
 }
 
 // Value returns the fetched secret value or sub-value
@@ -50,169 +55,173 @@ func (fetched *FetchedVaultSecret) IsMissingData() bool {
 	return fetched.isMissingData
 }
 
-// UploadNew modifies the remote secret and replaces the value or sub-value with
-// a new given value, and returns the new secret version
-func (fetched *FetchedVaultSecret) UploadNew(value interface{}) (interface{}, error) {
-	type secretPost struct {
-		Options struct {
-			CAS *int `json:"cas"`
-		} `json:"options"`
-		Data map[string]interface{} `json:"data"`
+// Lease returns the lease of a dynamic secret, or nil for a K/V secret
+func (fetched *FetchedVaultSecret) Lease() *types.Lease {
+	return fetched.lease
+}
+
+// FetchVersion fetches an older version of this secret from the K/V v2
+// version history. K/V v1 has no version history, so only the current version
+// is available
+func (fetched *FetchedVaultSecret) FetchVersion(version interface{}) (interface{}, bool, error) {
+	if fetched.lease != nil {
+		return nil, false, nil
 	}
 
-	type okResponse struct {
-		Data struct {
-			Version int `json:"version"`
-		} `json:"data"`
+	if fetched.kvVersion == 1 {
+		if version == fetched.version && !fetched.isMissingData {
+			return fetched.value, true, nil
+		}
+
+		return nil, false, nil
 	}
 
-	type errorResponse struct {
-		Data struct {
-			Error string `json:"error"`
-		} `json:"data"`
+	versionNumber, ok := version.(int)
+	if !ok || versionNumber < 1 {
+		return nil, false, nil
 	}
 
 	token, err := auth.GetTokenForURL(fetched.apiURL)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
-	for {
-		// Get the latest secret data and version
-		req, _ := http.NewRequest("GET", fetched.apiURL.String(), nil)
-		req.Header.Add("Authorization", "Bearer "+token)
-		resp, err := http.DefaultClient.Do(req)
-		if err != nil {
-			return nil, err
-		}
+	s := &session{
+		token:     token,
+		namespace: fetched.namespace,
+	}
+
+	versionURL := *fetched.apiURL
+	versionURL.RawQuery = "version=" + strconv.Itoa(versionNumber)
 
-		body, err := ioutil.ReadAll(resp.Body)
-		resp.Body.Close()
+	document, err := readKV(s, &versionURL, fetched.kvVersion)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Deleted and destroyed versions have no data
+	if document == nil || document.data == nil {
+		return nil, false, nil
+	}
+
+	value, isMissingData, err := fetched.mapping.Extract(document.data)
+	if err != nil || isMissingData {
+		return nil, false, err
+	}
+
+	if fetched.transit != nil {
+		value, err = fetched.transit.decrypt(s, fetched.secretURL, &fetched.mapping, value)
 		if err != nil {
-			return nil, err
+			return nil, false, err
 		}
+	}
 
-		var cas int
-		var data map[string]interface{}
+	return value, true, nil
+}
 
-		if resp.StatusCode == 404 {
-			cas = 0
-			data = make(map[string]interface{})
-		} else if resp.StatusCode == 200 {
-			rawSecretData := rawSecret{}
-			err = json.Unmarshal(body, &rawSecretData)
-			if err != nil {
-				return nil, err
-			}
+// BatchKey returns the namespace and API URL of the secret document, or an
+// empty string for dynamic secrets since they can't be uploaded
+func (fetched *FetchedVaultSecret) BatchKey() string {
+	if fetched.lease != nil {
+		return ""
+	}
 
-			cas = rawSecretData.Data.Metadata.Version
-			data = rawSecretData.Data.Data
-		} else {
-			return nil, errors.New("Got status " + resp.Status + " while fetching secret for push")
-		}
+	return fetched.namespace + "@" + fetched.apiURL.String()
+}
 
-		var dataAsInterface interface{} = data
+// UploadNew modifies the remote secret and replaces the value or sub-value with
+// a new given value, and returns the new secret version
+func (fetched *FetchedVaultSecret) UploadNew(value interface{}) (interface{}, error) {
+	return fetched.UploadBatch([]types.BatchUpload{
+		{Secret: fetched, Value: value},
+	})
+}
 
-		// Modify the secret based on the mapping
-		if fetched.mapping.FromData != nil {
-			err = util.SetAtPath(&dataAsInterface, fetched.mapping.FromData.Path, value)
-		} else if fetched.mapping.FromText != nil {
-			err = util.SetAtPath(&dataAsInterface, &fetched.mapping.FromText.Path, value)
-		}
+// UploadBatch modifies the remote secret and replaces the value or sub-value of
+// every secret in the batch with a single check-and-set write, and returns the
+// new secret version
+func (fetched *FetchedVaultSecret) UploadBatch(batch []types.BatchUpload) (interface{}, error) {
+	if fetched.lease != nil {
+		return nil, errors.New("dynamic secrets are read-only and cannot be pushed")
+	}
 
-		if err != nil {
-			return nil, err
-		}
+	token, err := auth.GetTokenForURL(fetched.apiURL)
+	if err != nil {
+		return nil, err
+	}
 
-		// Upload the modified secret with check-and-set
-		var postData secretPost
+	s := &session{
+		token:     token,
+		namespace: fetched.namespace,
+	}
 
-		postData.Options.CAS = &cas
-		postData.Data = dataAsInterface.(map[string]interface{})
+	batchSecrets := make([]*FetchedVaultSecret, len(batch))
+	values := make([]interface{}, len(batch))
 
-		postBytes, err := json.Marshal(postData)
-		if err != nil {
-			return nil, err
+	for idx, upload := range batch {
+		batchSecret, ok := upload.Secret.(*FetchedVaultSecret)
+		if !ok || batchSecret.BatchKey() != fetched.BatchKey() {
+			return nil, errors.New("cannot upload secrets from different Vault secrets in the same batch")
 		}
 
-		req, _ = http.NewRequest("POST", fetched.apiURL.String(), bytes.NewReader(postBytes))
-		req.Header.Add("Authorization", "Bearer "+token)
-		req.Header.Add("Content-Type", "application/json")
-		resp, err = http.DefaultClient.Do(req)
-		if err != nil {
-			return nil, err
+		batchSecrets[idx] = batchSecret
+		values[idx] = upload.Value
+
+		if batchSecret.transit != nil {
+			values[idx], err = batchSecret.transit.encrypt(s, batchSecret.secretURL, &batchSecret.mapping, upload.Value)
+			if err != nil {
+				return nil, err
+			}
 		}
+	}
 
-		body, err = ioutil.ReadAll(resp.Body)
-		resp.Body.Close()
+	for {
+		// Get the latest secret data and version
+		previous, err := readKV(s, fetched.apiURL, fetched.kvVersion)
 		if err != nil {
 			return nil, err
 		}
 
-		if resp.StatusCode == 200 {
-			// check-and-set succeeded, data was written, return the new version
+		data := make(map[string]interface{})
+		if previous != nil && previous.data != nil {
+			data = previous.data
+		}
 
-			okData := okResponse{}
-			err = json.Unmarshal(body, &okData)
+		// Modify the secret based on every mapping
+		for idx, batchSecret := range batchSecrets {
+			data, err = batchSecret.mapping.Apply(data, values[idx])
 			if err != nil {
 				return nil, err
 			}
-
-			return okData.Data.Version, nil
 		}
 
-		errorData := errorResponse{}
-		err = json.Unmarshal(body, &errorData)
+		// Upload the modified secret with check-and-set
+		newVersion, written, err := writeKV(s, fetched.apiURL, fetched.kvVersion, previous, data)
 		if err != nil {
-			return nil, errors.New("Got status " + resp.Status + " while setting secret")
+			return nil, err
 		}
 
-		if errorData.Data.Error != casMismatch {
-			return nil, errors.New("Got status " + resp.Status + " while setting secret")
+		if written {
+			forgetKV(s, fetched.apiURL)
+
+			return newVersion, nil
 		}
 
 		// If there was a CAS mismatch, then do the whole thing over again
-		fmt.Println("info: remote secret was edited during push, retrying")
+		util.Log.Debugf("remote secret was edited during push, retrying")
 	}
 }
 
 // SecretConfig contains the Vault-specific configuration parameters for a
 // secret in secrets.yaml
 type SecretConfig struct {
-	URL     string  `yaml:"url"`
-	Mapping Mapping `yaml:"mapping"`
-}
-
-// Mapping represents a data or text mapping of a Vault key/value secret
-// document to file contents
-type Mapping struct {
-	FromData *FromDataMapping `yaml:"fromData,omitempty"`
-	FromText *FromTextMapping `yaml:"fromText,omitempty"`
-}
-
-// FromDataMapping contains the settings for mapping a subset of the data of a
-// Vault key/value secret document to file contents
-type FromDataMapping struct {
-	Format string         `yaml:"format"`
-	Path   *[]interface{} `yaml:"path,omitempty"`
-}
-
-// FromTextMapping contains the settings for mapping a string value in the data
-// of a Vault key/value secret document to file contents
-type FromTextMapping struct {
-	Path []interface{} `yaml:"path"`
-}
-
-type rawSecret struct {
-	Data struct {
-		Data     map[string]interface{} `json:"data"`
-		Metadata struct {
-			CreatedTime  string `json:"created_time"`
-			DeletionTime string `json:"deletion_time"`
-			Destroyed    bool   `json:"destroyed"`
-			Version      int    `json:"version"`
-		} `json:"metadata"`
-	} `json:"data"`
+	URL       string          `yaml:"url"`
+	Namespace string          `yaml:"namespace,omitempty"`
+	Mount     string          `yaml:"mount,omitempty"`
+	KVVersion int             `yaml:"kvVersion,omitempty"`
+	Dynamic   *DynamicConfig  `yaml:"dynamic,omitempty"`
+	Transit   *TransitConfig  `yaml:"transit,omitempty"`
+	Mapping   mapping.Mapping `yaml:"mapping"`
 }
 
 // Prepare ensures that the Vault engine has all the required authentication
@@ -223,9 +232,64 @@ func (secretConfig *SecretConfig) Prepare() error {
 		return err
 	}
 
+	// Check before asking for credentials that would be sent in plain text
+	err = checkScheme(parsedURL)
+	if err != nil {
+		return err
+	}
+
 	return auth.PrepareForURL(parsedURL)
 }
 
+// resolveMount returns the mount path and K/V version of this secret. Explicit
+// settings in the secret config take priority, then any settings discovered
+// from Vault, and otherwise the mount is assumed to be the first path segment
+// of a K/V v2 secrets engine
+func (secretConfig *SecretConfig) resolveMount(s *session, parsedURL *url.URL) (string, int, error) {
+	switch secretConfig.KVVersion {
+	case 0, 1, 2:
+	default:
+		return "", 0, fmt.Errorf("unsupported K/V version %d", secretConfig.KVVersion)
+	}
+
+	mountPath := secretConfig.Mount
+	kvVersion := secretConfig.KVVersion
+
+	if mountPath == "" || kvVersion == 0 {
+		discovered, err := discoverMount(s, parsedURL)
+		if err != nil {
+			return "", 0, err
+		}
+
+		if discovered != nil {
+			if mountPath == "" {
+				mountPath = discovered.path
+			}
+
+			if kvVersion == 0 {
+				kvVersion = discovered.kvVersion
+			}
+		}
+	}
+
+	if kvVersion == 0 {
+		kvVersion = 2
+	}
+
+	return mountPath, kvVersion, nil
+}
+
+// IsDynamic returns true if this secret is a dynamic secret, which is issued
+// fresh every time it's fetched
+func (secretConfig *SecretConfig) IsDynamic() bool {
+	return secretConfig.Dynamic != nil
+}
+
+// Describe returns the URL of this secret
+func (secretConfig *SecretConfig) Describe() string {
+	return secretConfig.URL
+}
+
 // Fetch downloads this secret and returns an instance of FetchedVaultSecret
 func (secretConfig *SecretConfig) Fetch() (types.FetchedSecret, error) {
 	parsedURL, err := url.Parse(secretConfig.URL)
@@ -233,116 +297,128 @@ func (secretConfig *SecretConfig) Fetch() (types.FetchedSecret, error) {
 		return nil, err
 	}
 
-	var secret FetchedVaultSecret
+	secret := FetchedVaultSecret{
+		version: 0,
+	}
 
 	// Compute the format first in case of an early exit (i.e. 404)
-	if secretConfig.Mapping.FromData != nil {
-		switch secretConfig.Mapping.FromData.Format {
-		case "json":
-			secret.format = util.FormatJSON
-		case "yaml":
-			secret.format = util.FormatYaml
-		default:
-			return nil, errors.New("unknown format")
+	secret.format, err = secretConfig.Mapping.Format()
+	if err != nil {
+		return nil, err
+	}
+
+	secret.secretURL = parsedURL
+	secret.mapping = secretConfig.Mapping
+	secret.transit = secretConfig.Transit
+	secret.namespace = namespaceForSecret(parsedURL, secretConfig.Namespace)
+
+	if secretConfig.Transit != nil {
+		if secretConfig.Dynamic != nil {
+			return nil, errors.New("transit encryption is not supported for dynamic secrets")
 		}
-	} else if secretConfig.Mapping.FromText != nil {
-		secret.format = util.FormatText
 
-		if len(secretConfig.Mapping.FromText.Path) == 0 {
-			return nil, errors.New("no path provided for fromText secret mapping")
+		err = secretConfig.Transit.validate(&secretConfig.Mapping)
+		if err != nil {
+			return nil, err
 		}
-	} else {
-		return nil, errors.New("no mapping provided for secret")
 	}
 
-	secret.mapping = secretConfig.Mapping
+	if secretConfig.Dynamic != nil {
+		return secretConfig.fetchDynamic(parsedURL, &secret)
+	}
 
-	// Insert /data into the secret path after the secrets engine, assuming k/v
-	// engine v2
-	path := parsedURL.Path
-	idx := strings.IndexRune(path[1:], '/')
-	if idx == -1 {
-		return nil, errors.New("URL has only one path segment")
+	token, err := auth.GetTokenForURL(parsedURL)
+	if err != nil {
+		return nil, err
 	}
-	idx++
 
-	parsedURL.Path = "/v1" + path[:idx] + "/data" + path[idx:]
-	secret.apiURL = parsedURL
+	s := &session{
+		token:     token,
+		namespace: secret.namespace,
+	}
 
-	// Get the secret data
-	token, err := auth.GetTokenForURL(parsedURL)
+	mountPath, kvVersion, err := secretConfig.resolveMount(s, parsedURL)
 	if err != nil {
 		return nil, err
 	}
 
-	req, _ := http.NewRequest("GET", parsedURL.String(), nil)
-	req.Header.Add("Authorization", "Bearer "+token)
-	resp, err := http.DefaultClient.Do(req)
+	secret.kvVersion = kvVersion
+	secret.apiURL, err = kvAPIURL(parsedURL, mountPath, kvVersion)
 	if err != nil {
 		return nil, err
 	}
 
-	body, err := ioutil.ReadAll(resp.Body)
-	resp.Body.Close()
+	// Get the secret data, which may already have been fetched for another
+	// secret in the same document
+	document, err := readKVOnce(s, secret.apiURL, secret.kvVersion)
 	if err != nil {
 		return nil, err
 	}
 
-	if resp.StatusCode == 404 {
+	if document == nil {
 		secret.isMissingData = true
 		return &secret, nil
-	} else if resp.StatusCode != 200 {
-		return nil, errors.New("Got status " + resp.Status + " while fetching secret")
 	}
 
-	rawSecretData := rawSecret{}
-	err = json.Unmarshal(body, &rawSecretData)
+	secret.version = document.version
+
+	// Process secret data
+	secret.value, secret.isMissingData, err = secretConfig.Mapping.Extract(document.data)
 	if err != nil {
 		return nil, err
 	}
 
-	secret.version = rawSecretData.Data.Metadata.Version
-
-	// Process secret data
-	if secretConfig.Mapping.FromData != nil {
-		var data interface{}
-
-		if secretConfig.Mapping.FromData.Path != nil {
-			data, err = util.TraversePath(rawSecretData.Data.Data, secretConfig.Mapping.FromData.Path)
-			if err != nil {
-				if util.IsMissingData(err) {
-					secret.isMissingData = true
-					return &secret, nil
-				}
-
-				return nil, err
-			}
-		} else {
-			data = rawSecretData.Data.Data
+	if secretConfig.Transit != nil && !secret.isMissingData {
+		if !isCiphertext(secret.value) {
+			// Plaintext from before transit encryption was set up is treated
+			// as missing, so the local file gets pushed to encrypt it
+			util.Log.Warnf("secret value at '%s' is not encrypted with transit key '%s' yet, push it to encrypt it", parsedURL.String(), secretConfig.Transit.Key)
+			secret.isMissingData = true
+			return &secret, nil
 		}
 
-		secret.value = data
-	} else if secretConfig.Mapping.FromText != nil {
-		data, err := util.TraversePath(rawSecretData.Data.Data, &secretConfig.Mapping.FromText.Path)
+		secret.value, err = secretConfig.Transit.decrypt(s, parsedURL, &secretConfig.Mapping, secret.value)
 		if err != nil {
-			if util.IsMissingData(err) {
-				secret.isMissingData = true
-				return &secret, nil
-			}
-
 			return nil, err
 		}
-
-		switch v := data.(type) {
-		case string:
-			secret.value = v
-		default:
-			return nil, errors.New("Value for text mapping is not a string")
-		}
 	}
 
 	return &secret, nil
 }
 
+// fetchDynamic issues a new dynamic secret
+func (secretConfig *SecretConfig) fetchDynamic(parsedURL *url.URL, secret *FetchedVaultSecret) (types.FetchedSecret, error) {
+	token, err := auth.GetTokenForURL(parsedURL)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &session{
+		token:     token,
+		namespace: secret.namespace,
+	}
+
+	secret.apiURL = dynamicAPIURL(parsedURL)
+
+	data, lease, err := issueDynamic(s, secret.apiURL, secretConfig.Dynamic)
+	if err != nil {
+		return nil, err
+	}
+
+	secret.lease = lease
+	secret.version, err = dynamicVersion(data, lease)
+	if err != nil {
+		return nil, err
+	}
+
+	// Process secret data
+	secret.value, secret.isMissingData, err = secretConfig.Mapping.Extract(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return secret, nil
+}
+
 // TODO: for future, use this code for example in grabbing Vault secret
 // https://github.com/hashicorp/consul-template/blob/7eebde9030a600fec83820fad6cfed2f9ecbd77c/dependency/vault_read.go#L36
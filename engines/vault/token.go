@@ -0,0 +1,129 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/madwire-media/secrets-cli/util"
+)
+
+// defaultTokenTTL is how long a token is cached for if its TTL can't be looked
+// up, which is Vault's default max TTL of 768h
+const defaultTokenTTL = 32 * 24 * time.Hour
+
+// tokenLookupResponse is the part of an auth/token/lookup-self response used
+// to track a token's lifetime
+type tokenLookupResponse struct {
+	Data struct {
+		TTL       int64 `json:"ttl"`
+		Renewable bool  `json:"renewable"`
+	} `json:"data"`
+}
+
+// tokenRenewResponse is the part of an auth/token/renew-self response used to
+// track a token's lifetime
+type tokenRenewResponse struct {
+	Auth struct {
+		LeaseDuration int64 `json:"lease_duration"`
+		Renewable     bool  `json:"renewable"`
+	} `json:"auth"`
+}
+
+// lookupSelfURL returns the URL of the token lookup endpoint on a secret's
+// host, which can be used to validate tokens without side effects
+func lookupSelfURL(secretURL *url.URL) *url.URL {
+	return tokenAPIURL(secretURL, "lookup-self")
+}
+
+func tokenAPIURL(secretURL *url.URL, endpoint string) *url.URL {
+	apiURL := *secretURL
+	apiURL.Path = "/v1/auth/token/" + endpoint
+	apiURL.RawQuery = ""
+	apiURL.Fragment = ""
+
+	return &apiURL
+}
+
+// newCachedToken builds a cache entry for a token that expires after ttl
+// seconds, or never expires if ttl is 0. Tokens are renewed once two thirds of
+// their TTL has passed, the same as dynamic secrets
+func newCachedToken(token string, ttl int64, renewable bool) cachedToken {
+	cached := cachedToken{
+		Token:     token,
+		Renewable: renewable,
+	}
+
+	if ttl > 0 {
+		now := time.Now().Unix()
+
+		cached.Expires = now + ttl
+		cached.RenewAfter = now + ttl*2/3
+	}
+
+	return cached
+}
+
+// needsRenewal returns true if a cached token is near expiry
+func (cached *cachedToken) needsRenewal(now int64) bool {
+	return cached.Expires != 0 && cached.RenewAfter != 0 && now >= cached.RenewAfter
+}
+
+// lookupToken looks up the lifetime of a newly issued token and builds a cache
+// entry for it. If the lookup fails the token is cached for the default TTL
+func lookupToken(parsedURL *url.URL, namespace string, token string) cachedToken {
+	s := &session{
+		token:     token,
+		namespace: namespace,
+	}
+
+	resp, body, err := s.do("GET", lookupSelfURL(parsedURL).String(), nil)
+	if err == nil && resp.StatusCode != 200 {
+		err = errors.New("Got status " + resp.Status + " while looking up token")
+	}
+
+	lookup := tokenLookupResponse{}
+	if err == nil {
+		err = json.Unmarshal(body, &lookup)
+	}
+
+	if err != nil {
+		util.Log.Debugf("could not look up token TTL for Vault instance at '%s', assuming %s: %s", parsedURL.Host, defaultTokenTTL, err)
+
+		cached := newCachedToken(token, int64(defaultTokenTTL/time.Second), false)
+
+		// Without a real TTL there's nothing to renew from
+		cached.RenewAfter = 0
+
+		return cached
+	}
+
+	return newCachedToken(token, lookup.Data.TTL, lookup.Data.Renewable)
+}
+
+// renewToken renews a token, returning its new cache entry. Tokens can't be
+// renewed past their max TTL, so the new TTL may be shorter than before
+func renewToken(parsedURL *url.URL, namespace string, token string) (cachedToken, error) {
+	s := &session{
+		token:     token,
+		namespace: namespace,
+	}
+
+	resp, body, err := s.do("POST", tokenAPIURL(parsedURL, "renew-self").String(), nil)
+	if err != nil {
+		return cachedToken{}, err
+	}
+
+	if resp.StatusCode != 200 {
+		return cachedToken{}, errors.New("Got status " + resp.Status + " while renewing token")
+	}
+
+	renewed := tokenRenewResponse{}
+	err = json.Unmarshal(body, &renewed)
+	if err != nil {
+		return cachedToken{}, err
+	}
+
+	return newCachedToken(token, renewed.Auth.LeaseDuration, renewed.Auth.Renewable), nil
+}
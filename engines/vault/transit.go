@@ -0,0 +1,174 @@
+package vault
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/madwire-media/secrets-cli/engines/mapping"
+)
+
+const (
+	defaultTransitMount = "transit"
+
+	// transitCiphertextPrefix is the prefix of every ciphertext produced by the
+	// transit secrets engine, followed by the key version
+	transitCiphertextPrefix = "vault:v"
+)
+
+// TransitConfig contains the settings for encrypting a secret's value with a
+// Vault transit key before it's stored, so the K/V secret only ever holds
+// ciphertext
+type TransitConfig struct {
+	Mount string `yaml:"mount,omitempty"`
+	Key   string `yaml:"key"`
+}
+
+func (transit *TransitConfig) validate(secretMapping *mapping.Mapping) error {
+	if transit.Key == "" {
+		return errors.New("no key provided for transit encryption")
+	}
+
+	// The ciphertext is a string, so it can't replace the whole document
+	if secretMapping.FromData != nil && secretMapping.FromData.Path == nil {
+		return errors.New("transit encryption requires a path in the fromData mapping")
+	}
+
+	return nil
+}
+
+// isCiphertext checks if a value stored in a secret is transit ciphertext, and
+// not plaintext that was stored before transit encryption was set up
+func isCiphertext(stored interface{}) bool {
+	ciphertext, ok := stored.(string)
+	return ok && strings.HasPrefix(ciphertext, transitCiphertextPrefix)
+}
+
+// transitAPIURL returns the URL of a transit endpoint, like encrypt or decrypt,
+// for this transit key on a secret's host
+func (transit *TransitConfig) transitAPIURL(secretURL *url.URL, operation string) *url.URL {
+	mount := strings.Trim(transit.Mount, "/")
+	if mount == "" {
+		mount = defaultTransitMount
+	}
+
+	apiURL := *secretURL
+	apiURL.Path = "/v1/" + mount + "/" + operation + "/" + transit.Key
+	apiURL.RawQuery = ""
+	apiURL.Fragment = ""
+
+	return &apiURL
+}
+
+// encrypt encrypts a secret value, which is JSON-encoded first unless it's a
+// text secret, and returns the ciphertext
+func (transit *TransitConfig) encrypt(s *session, secretURL *url.URL, secretMapping *mapping.Mapping, value interface{}) (string, error) {
+	type encryptRequest struct {
+		Plaintext string `json:"plaintext"`
+	}
+
+	type encryptResponse struct {
+		Data struct {
+			Ciphertext string `json:"ciphertext"`
+		} `json:"data"`
+	}
+
+	var plaintext []byte
+
+	if secretMapping.FromText != nil {
+		text, ok := value.(string)
+		if !ok {
+			return "", errors.New("Value for text mapping is not a string")
+		}
+
+		plaintext = []byte(text)
+	} else {
+		var err error
+
+		plaintext, err = json.Marshal(value)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	resp, body, err := s.do("POST", transit.transitAPIURL(secretURL, "encrypt").String(), encryptRequest{
+		Plaintext: base64.StdEncoding.EncodeToString(plaintext),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode != 200 {
+		return "", statusError(resp, "encrypting secret")
+	}
+
+	encrypted := encryptResponse{}
+	err = json.Unmarshal(body, &encrypted)
+	if err != nil {
+		return "", err
+	}
+
+	if encrypted.Data.Ciphertext == "" {
+		return "", errors.New("transit encryption response has no ciphertext")
+	}
+
+	return encrypted.Data.Ciphertext, nil
+}
+
+// decrypt decrypts a ciphertext stored in a secret, decoding it as JSON unless
+// it's a text secret
+func (transit *TransitConfig) decrypt(s *session, secretURL *url.URL, secretMapping *mapping.Mapping, stored interface{}) (interface{}, error) {
+	type decryptRequest struct {
+		Ciphertext string `json:"ciphertext"`
+	}
+
+	type decryptResponse struct {
+		Data struct {
+			Plaintext string `json:"plaintext"`
+		} `json:"data"`
+	}
+
+	if !isCiphertext(stored) {
+		return nil, fmt.Errorf("secret value at '%s' is not transit ciphertext", secretURL.String())
+	}
+
+	ciphertext := stored.(string)
+
+	resp, body, err := s.do("POST", transit.transitAPIURL(secretURL, "decrypt").String(), decryptRequest{
+		Ciphertext: ciphertext,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != 200 {
+		return nil, statusError(resp, "decrypting secret")
+	}
+
+	decrypted := decryptResponse{}
+	err = json.Unmarshal(body, &decrypted)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := base64.StdEncoding.DecodeString(decrypted.Data.Plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	if secretMapping.FromText != nil {
+		return string(plaintext), nil
+	}
+
+	var value interface{}
+
+	err = json.Unmarshal(plaintext, &value)
+	if err != nil {
+		return nil, fmt.Errorf("decrypted secret at '%s' is not JSON: %s", secretURL.String(), err.Error())
+	}
+
+	return value, nil
+}
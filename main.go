@@ -3,6 +3,11 @@ package main
 import (
 	"github.com/madwire-media/secrets-cli/cmd"
 	"github.com/madwire-media/secrets-cli/util"
+
+	// Secret engines register themselves with the engines package
+	_ "github.com/madwire-media/secrets-cli/engines/aws"
+	_ "github.com/madwire-media/secrets-cli/engines/local"
+	_ "github.com/madwire-media/secrets-cli/engines/vault"
 )
 
 func main() {
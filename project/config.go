@@ -29,6 +29,8 @@ type Project struct {
 	path         string
 	lastState    LockState
 	currentState LockState
+	dryRun       bool
+	events       []SyncEvent
 }
 
 // Config is the root configuration for a secrets.yaml file
@@ -63,6 +65,8 @@ func OpenProject() (*Project, error) {
 		project.path = parent
 	}
 
+	vars.ProjectDir = project.path
+
 	text, err := ioutil.ReadFile(filepath.Join(project.path, "secrets.yaml"))
 	if err != nil {
 		return nil, err
@@ -147,7 +151,7 @@ func (project *Project) applyClassUpdate(update ClassUpdate) error {
 		}
 	}
 
-	if !vars.IsCICD {
+	if !vars.IsCICD && !project.dryRun {
 		err := project.saveClasses()
 		if err != nil {
 			return err
@@ -0,0 +1,117 @@
+package project
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/madwire-media/secrets-cli/util"
+	"github.com/madwire-media/secrets-cli/vars"
+)
+
+// SecretDiff is the difference between the remote value and the local file of
+// a secret, with the filename relative to the working directory. If the secret
+// couldn't be diffed then Note explains why
+type SecretDiff struct {
+	File  string
+	Lines []util.DiffLine
+	Note  string
+}
+
+// Diff fetches secrets and diffs their remote values against their local
+// files, returning only the secrets that differ. If filename is empty then
+// every secret in the saved classes is diffed, otherwise only the secret
+// stored at that file is. Dynamic secrets are never fetched since that would
+// issue a new secret. At most jobs secrets are prepared or fetched at once
+func (project *Project) Diff(filename string, reveal bool, jobs int) ([]SecretDiff, error) {
+	var secrets []SecretConfig
+
+	if filename == "" {
+		selectedSecrets, _ := filterSecrets(project.Secrets, project.classes)
+
+		for _, secret := range selectedSecrets {
+			if !secret.IsDynamic() {
+				secrets = append(secrets, secret)
+			}
+		}
+	} else {
+		secret, err := project.findSecret(filename)
+		if err != nil {
+			return nil, err
+		}
+
+		if secret.IsDynamic() {
+			return nil, fmt.Errorf("cannot diff dynamic secret '%s', fetching it would issue a new secret", filename)
+		}
+
+		secrets = []SecretConfig{*secret}
+	}
+
+	fetchedSecrets, err := prepareAndFetch(secrets, jobs)
+	if err != nil {
+		return nil, err
+	}
+
+	err = project.computeCurrentState(secrets, fetchedSecrets)
+	if err != nil {
+		return nil, err
+	}
+
+	diffs := []SecretDiff{}
+
+	for idx, secret := range secrets {
+		fetchedSecret := fetchedSecrets[idx]
+		fileState := project.currentState.Files[secret.File]
+
+		relativeFilename, err := project.relativeFilename(secret.File)
+		if err != nil {
+			return nil, err
+		}
+
+		diff := SecretDiff{
+			File: relativeFilename,
+		}
+
+		if fileState.formatError != nil {
+			diff.Note = "local file could not be parsed: " + fileState.formatError.Error()
+			diffs = append(diffs, diff)
+			continue
+		}
+
+		var remoteValue interface{}
+		if !fetchedSecret.IsMissingData() {
+			remoteValue = fetchedSecret.Value()
+		}
+
+		if fetchedSecret.Format() == util.FormatText {
+			remoteText, _ := remoteValue.(string)
+			localText, _ := fileState.data.(string)
+
+			diff.Lines = util.DiffText(remoteText, localText, reveal)
+		} else {
+			diff.Lines = util.DiffData(remoteValue, fileState.data, reveal)
+		}
+
+		if len(diff.Lines) > 0 {
+			diffs = append(diffs, diff)
+		}
+	}
+
+	return diffs, nil
+}
+
+// findSecret finds the secret config stored at a file, relative to the
+// working directory
+func (project *Project) findSecret(filename string) (*SecretConfig, error) {
+	absFilename := filepath.Clean(filename)
+	if !filepath.IsAbs(absFilename) {
+		absFilename = filepath.Join(vars.Workdir, filename)
+	}
+
+	for idx, secret := range project.Secrets {
+		if filepath.Join(project.path, secret.File) == absFilename {
+			return &project.Secrets[idx], nil
+		}
+	}
+
+	return nil, fmt.Errorf("no secret is configured for file '%s'", filename)
+}
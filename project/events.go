@@ -0,0 +1,78 @@
+package project
+
+// Actions taken on a secret file during a sync, as reported in a SyncEvent. In
+// dry-run mode they are the actions that would have been taken
+const (
+	ActionPulled    = "pulled"
+	ActionPushed    = "pushed"
+	ActionDeleted   = "deleted"
+	ActionSkipped   = "skipped"
+	ActionUnchanged = "unchanged"
+	ActionFailed    = "failed"
+)
+
+// Reasons for a sync action that aren't already covered by a status state
+const (
+	ReasonWrongFormat   = "wrong format"
+	ReasonCorruptLock   = "corrupt lockfile"
+	ReasonDynamicSecret = "dynamic secret"
+	ReasonValidLease    = "valid lease"
+	ReasonRemoved       = "removed"
+)
+
+// SyncEvent is the outcome of a sync for a single secret file, with the
+// filename relative to the working directory. Reason is the state that led to
+// the action, usually one of the states reported by Status, and Error is set
+// if the action failed
+type SyncEvent struct {
+	File       string      `json:"file"`
+	Action     string      `json:"action"`
+	Reason     string      `json:"reason"`
+	OldVersion interface{} `json:"oldVersion,omitempty"`
+	NewVersion interface{} `json:"newVersion,omitempty"`
+	Error      string      `json:"error,omitempty"`
+}
+
+// SyncSummary counts the actions taken during a sync
+type SyncSummary struct {
+	Pulled    int  `json:"pulled"`
+	Pushed    int  `json:"pushed"`
+	Deleted   int  `json:"deleted"`
+	Skipped   int  `json:"skipped"`
+	Unchanged int  `json:"unchanged"`
+	Failed    int  `json:"failed"`
+	DryRun    bool `json:"dryRun"`
+}
+
+// SyncEvents returns an event for every secret file handled by the last sync,
+// in the order they were handled. Events are still recorded when a sync fails
+// partway through
+func (project *Project) SyncEvents() []SyncEvent {
+	return project.events
+}
+
+// SyncSummary counts the actions in the events of the last sync
+func (project *Project) SyncSummary() SyncSummary {
+	summary := SyncSummary{
+		DryRun: project.dryRun,
+	}
+
+	for _, event := range project.events {
+		switch event.Action {
+		case ActionPulled:
+			summary.Pulled++
+		case ActionPushed:
+			summary.Pushed++
+		case ActionDeleted:
+			summary.Deleted++
+		case ActionSkipped:
+			summary.Skipped++
+		case ActionUnchanged:
+			summary.Unchanged++
+		case ActionFailed:
+			summary.Failed++
+		}
+	}
+
+	return summary
+}
@@ -0,0 +1,87 @@
+package project
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"github.com/madwire-media/secrets-cli/types"
+	"github.com/madwire-media/secrets-cli/util"
+)
+
+// filterLeasedSecrets splits out dynamic secrets that don't need to be fetched
+// because their lease in the lockfile doesn't need renewing yet and their
+// local file hasn't changed. Fetching a dynamic secret issues a brand new one,
+// so these must be skipped to avoid issuing a new secret on every sync
+func (project *Project) filterLeasedSecrets(secrets []SecretConfig) ([]SecretConfig, []SecretConfig, error) {
+	fetchSecrets := []SecretConfig{}
+	leasedSecrets := []SecretConfig{}
+	now := time.Now().Unix()
+
+	for _, secret := range secrets {
+		fresh, err := project.hasFreshLease(secret, now)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if fresh {
+			leasedSecrets = append(leasedSecrets, secret)
+		} else {
+			fetchSecrets = append(fetchSecrets, secret)
+		}
+	}
+
+	return fetchSecrets, leasedSecrets, nil
+}
+
+func (project *Project) hasFreshLease(secret SecretConfig, now int64) (bool, error) {
+	// A lease left over from before a secret stopped being dynamic doesn't
+	// mean anything anymore
+	if !secret.IsDynamic() {
+		return false, nil
+	}
+
+	prevState, hasPrevState := project.lastState.Files[secret.File]
+	if !hasPrevState || prevState.Lease == nil {
+		return false, nil
+	}
+
+	if prevState.Lease.Expires != 0 && prevState.Lease.RenewAfter <= now {
+		return false, nil
+	}
+
+	bytes, err := ioutil.ReadFile(filepath.Join(project.path, secret.File))
+	if err != nil {
+		return false, nil
+	}
+
+	parsed, err := util.ParseData(bytes, util.NameToFormat(prevState.LocalFormat))
+	if err != nil {
+		return false, nil
+	}
+
+	hash, err := hashValue(&parsed)
+	if err != nil {
+		return false, err
+	}
+
+	return hash == prevState.LocalHash, nil
+}
+
+// leaseOf returns the lease of a fetched dynamic secret, or nil if the secret
+// isn't a dynamic secret
+func leaseOf(fetchedSecret types.FetchedSecret) *types.Lease {
+	if leased, ok := fetchedSecret.(types.LeasedSecret); ok {
+		return leased.Lease()
+	}
+
+	return nil
+}
+
+func formatLeaseExpiry(lease *types.Lease) string {
+	if lease.Expires == 0 {
+		return "never expires"
+	}
+
+	return "expires " + time.Unix(lease.Expires, 0).Format(time.RFC1123)
+}
@@ -0,0 +1,130 @@
+package project
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/madwire-media/secrets-cli/engines/vault"
+	"github.com/madwire-media/secrets-cli/types"
+	"github.com/madwire-media/secrets-cli/util"
+	"gopkg.in/yaml.v3"
+)
+
+const dynamicSecretYAML = `
+file: cert.pem
+vault:
+  url: https://vault.example.com/pki/issue/web
+  dynamic:
+    params:
+      common_name: web.example.com
+  mapping:
+    fromText:
+      path: [certificate]
+`
+
+const staticSecretYAML = `
+file: cert.pem
+vault:
+  url: https://vault.example.com/kv/web
+  mapping:
+    fromText:
+      path: [certificate]
+`
+
+// newLeasedProject makes a project with a local cert.pem file that the
+// lockfile says was pulled with a lease that never expires
+func newLeasedProject(t *testing.T) *Project {
+	dir := t.TempDir()
+	contents := []byte("CERTIFICATE")
+
+	err := ioutil.WriteFile(filepath.Join(dir, "cert.pem"), contents, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := util.ParseData(contents, util.FormatText)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash, err := hashValue(&parsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &Project{
+		path: dir,
+		lastState: LockState{
+			Files: map[string]LockedFile{
+				"cert.pem": {
+					RemoteVersion: "serial:aa:bb:01",
+					LocalHash:     hash,
+					LocalFormat:   util.FormatToName(util.FormatText),
+					Lease:         &types.Lease{},
+				},
+			},
+		},
+	}
+}
+
+func decodeSecret(t *testing.T, text string) SecretConfig {
+	var secret SecretConfig
+
+	err := yaml.Unmarshal([]byte(text), &secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return secret
+}
+
+func TestFilterLeasedSecretsKeepsDynamicLease(t *testing.T) {
+	project := newLeasedProject(t)
+	secret := decodeSecret(t, dynamicSecretYAML)
+
+	fetchSecrets, leasedSecrets, err := project.filterLeasedSecrets([]SecretConfig{secret})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(leasedSecrets) != 1 || len(fetchSecrets) != 0 {
+		t.Errorf("expected dynamic secret with a fresh lease to be skipped, got %d leased and %d to fetch", len(leasedSecrets), len(fetchSecrets))
+	}
+}
+
+func TestFilterLeasedSecretsIgnoresLeaseAfterSwitchToStatic(t *testing.T) {
+	project := newLeasedProject(t)
+	secret := decodeSecret(t, staticSecretYAML)
+
+	fetchSecrets, leasedSecrets, err := project.filterLeasedSecrets([]SecretConfig{secret})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(leasedSecrets) != 0 || len(fetchSecrets) != 1 {
+		t.Fatalf("expected static secret to be fetched despite its old lease, got %d leased and %d to fetch", len(leasedSecrets), len(fetchSecrets))
+	}
+
+	// Neither does the lease make it into the next lockfile
+	err = project.computeCurrentState(fetchSecrets, []types.FetchedSecret{&staticFetchedSecret{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if lease := project.currentState.Files["cert.pem"].Lease; lease != nil {
+		t.Errorf("expected no lease for static secret, got %+v", lease)
+	}
+}
+
+// staticFetchedSecret is a fetched text secret that isn't dynamic
+type staticFetchedSecret struct{}
+
+func (*staticFetchedSecret) Value() interface{}   { return "CERTIFICATE" }
+func (*staticFetchedSecret) Version() interface{} { return 2 }
+func (*staticFetchedSecret) Format() int          { return util.FormatText }
+func (*staticFetchedSecret) IsMissingData() bool  { return false }
+
+func (*staticFetchedSecret) UploadNew(value interface{}) (interface{}, error) {
+	return nil, nil
+}
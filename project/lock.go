@@ -25,9 +25,10 @@ type LockState struct {
 
 // LockedFile represents the state of a particular secret file
 type LockedFile struct {
-	RemoteVersion interface{} `yaml:"remoteVersion,omitempty"`
-	LocalHash     string      `yaml:"localHash,omitempty"`
-	LocalFormat   string      `yaml:"localFormat"`
+	RemoteVersion interface{}  `yaml:"remoteVersion,omitempty"`
+	LocalHash     string       `yaml:"localHash,omitempty"`
+	LocalFormat   string       `yaml:"localFormat"`
+	Lease         *types.Lease `yaml:"lease,omitempty"`
 	formatError   error
 	data          interface{}
 }
@@ -75,6 +76,24 @@ func (project *Project) saveCurrentState() error {
 	return nil
 }
 
+// currentStateChanged returns true if saving the current state would change
+// the lockfile
+func (project *Project) currentStateChanged() (bool, error) {
+	filename := filepath.Join(project.path, "secrets.lock")
+
+	lockBytes, err := yaml.Marshal(&project.currentState)
+	if err != nil {
+		return false, err
+	}
+
+	existingBytes, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return true, nil
+	}
+
+	return !bytes.Equal(lockBytes, existingBytes), nil
+}
+
 func (project *Project) computeCurrentState(
 	secrets []SecretConfig,
 	fetched []types.FetchedSecret,
@@ -88,8 +107,10 @@ func (project *Project) computeCurrentState(
 		correctedFilename := filepath.Join(project.path, secret.File)
 		prevState, hasPrevState := project.lastState.Files[secret.File]
 
+		// Only dynamic secrets get a lease, once they're pulled
 		fileState := LockedFile{
 			RemoteVersion: fetchedSecret.Version(),
+			Lease:         nil,
 		}
 
 		bytes, err := ioutil.ReadFile(correctedFilename)
@@ -104,10 +125,6 @@ func (project *Project) computeCurrentState(
 				format := util.NameToFormat(prevState.LocalFormat)
 
 				data, err := util.ParseData(bytes, format)
-				if err != nil {
-					return err
-				}
-
 				if err == nil {
 					parsedSuccessfully = true
 					parsed = data
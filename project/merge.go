@@ -0,0 +1,250 @@
+package project
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/madwire-media/secrets-cli/types"
+	"github.com/madwire-media/secrets-cli/util"
+)
+
+// mergeSecret does a three-way merge of a data secret that was modified both
+// locally and remotely, using the remote version in the lockfile as the base.
+// Only keys changed on both sides need to be resolved by the user. The merged
+// value is written to the local file, and the returned bool is true if the
+// secret was merged and should be pushed. If the secret can't be merged, or a
+// conflict can't be resolved, false is returned without an error
+func (project *Project) mergeSecret(
+	secret SecretConfig,
+	fetchedSecret types.FetchedSecret,
+	fileState *LockedFile,
+	prevState LockedFile,
+	relativeFilename string,
+) (bool, error) {
+	if fetchedSecret.Format() == util.FormatText {
+		return false, nil
+	}
+
+	if _, ok := fetchedSecret.(types.VersionedSecret); !ok {
+		return false, nil
+	}
+
+	base, ok, err := fetchMergeBase(fetchedSecret, prevState)
+	if err != nil {
+		return false, err
+	}
+
+	if !ok {
+		util.Log.Infof("Last synced version of '%s' is not available, cannot merge", relativeFilename)
+		return false, nil
+	}
+
+	unresolved := false
+
+	merged, err := util.MergeData(base, fileState.data, fetchedSecret.Value(), func(conflict util.MergeConflict) (bool, error) {
+		if !project.isInteractive() {
+			unresolved = true
+			return true, nil
+		}
+
+		fmt.Printf("Modified secret file '%s' and its modified remote copy both changed '%s'\n", relativeFilename, conflict.Path)
+
+		return cliQuestionLocalRemote(conflict), nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	if unresolved {
+		util.Log.Infof("Modified secret file '%s' and its modified remote copy changed the same keys, cannot merge", relativeFilename)
+		return false, nil
+	}
+
+	err = project.writeSecretFile(secret, merged, fetchedSecret.Format(), fileState)
+	if err != nil {
+		return false, err
+	}
+
+	fileState.data = merged
+
+	return true, nil
+}
+
+// mergeSecretWithTool lets the user merge a secret that was modified both
+// locally and remotely with their merge tool. The local, remote, and last
+// synced versions are written to temp files, and the merged file is written to
+// the local file if the merge tool succeeds. The returned bool is true if the
+// secret was merged and should be pushed
+func (project *Project) mergeSecretWithTool(
+	secret SecretConfig,
+	fetchedSecret types.FetchedSecret,
+	fileState *LockedFile,
+	prevState LockedFile,
+	relativeFilename string,
+) (bool, error) {
+	localData, err := ioutil.ReadFile(filepath.Join(project.path, secret.File))
+	if err != nil {
+		return false, err
+	}
+
+	remoteData, err := util.FormatData(fetchedSecret.Value(), fetchedSecret.Format())
+	if err != nil {
+		return false, err
+	}
+
+	// Merge without a base, like git does, if the base isn't available
+	baseData := ""
+
+	base, ok, err := fetchMergeBase(fetchedSecret, prevState)
+	if err != nil {
+		return false, err
+	}
+
+	if ok {
+		baseData, err = util.FormatData(base, fetchedSecret.Format())
+		if err != nil {
+			return false, err
+		}
+	} else {
+		util.Log.Infof("Last synced version of '%s' is not available, merging without a base", relativeFilename)
+	}
+
+	dir, err := ioutil.TempDir("", "secrets-merge-")
+	if err != nil {
+		return false, err
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Base(secret.File)
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+
+	files := util.MergeToolFiles{
+		Local:  filepath.Join(dir, stem+"_LOCAL"+ext),
+		Remote: filepath.Join(dir, stem+"_REMOTE"+ext),
+		Base:   filepath.Join(dir, stem+"_BASE"+ext),
+		Merged: filepath.Join(dir, name),
+	}
+
+	contents := map[string][]byte{
+		files.Local:  localData,
+		files.Remote: []byte(remoteData),
+		files.Merged: localData,
+	}
+
+	// $BASE is left empty when there is no base, like in git's mergetool
+	if ok {
+		contents[files.Base] = []byte(baseData)
+	} else {
+		files.Base = ""
+	}
+
+	for filename, data := range contents {
+		err = ioutil.WriteFile(filename, data, 0600)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	mergedInfo, err := os.Stat(files.Merged)
+	if err != nil {
+		return false, err
+	}
+
+	err = util.RunMergeTool(files)
+	if err != nil {
+		util.Log.Warnf("merge tool failed for '%s': %s", relativeFilename, err)
+		return false, nil
+	}
+
+	mergedData, err := ioutil.ReadFile(files.Merged)
+	if err != nil {
+		return false, err
+	}
+
+	// A merge tool that was closed without saving still exits successfully,
+	// which would push the local file over the remote changes
+	newMergedInfo, err := os.Stat(files.Merged)
+	if err != nil {
+		return false, err
+	}
+
+	if newMergedInfo.ModTime().Equal(mergedInfo.ModTime()) && bytes.Equal(mergedData, localData) {
+		fmt.Printf("Merged file for '%s' seems unchanged\n", relativeFilename)
+
+		if !util.CliQuestionYesNoDefault("Was the merge successful?", false) {
+			return false, nil
+		}
+	}
+
+	merged, err := util.ParseData(mergedData, fetchedSecret.Format())
+	if err != nil {
+		util.Log.Warnf("merged file for '%s' could not be parsed: %s", relativeFilename, err)
+		return false, nil
+	}
+
+	err = project.writeSecretFile(secret, merged, fetchedSecret.Format(), fileState)
+	if err != nil {
+		return false, err
+	}
+
+	fileState.data = merged
+
+	return true, nil
+}
+
+// fetchMergeBase fetches the remote version a secret was last synced with,
+// returning false if the secret engine can't fetch old versions or that
+// version is no longer available
+func fetchMergeBase(fetchedSecret types.FetchedSecret, prevState LockedFile) (interface{}, bool, error) {
+	versionedSecret, ok := fetchedSecret.(types.VersionedSecret)
+	if !ok {
+		return nil, false, nil
+	}
+
+	base, ok, err := versionedSecret.FetchVersion(prevState.RemoteVersion)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+
+	// Make sure the base is really what the local file was last synced with
+	baseHash, err := hashValue(base)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if baseHash != prevState.LocalHash {
+		return nil, false, nil
+	}
+
+	return base, true, nil
+}
+
+func cliQuestionLocalRemote(conflict util.MergeConflict) bool {
+	local := "local"
+	if !conflict.LocalExists {
+		local = "local (deleted)"
+	}
+
+	remote := "remote"
+	if !conflict.RemoteExists {
+		remote = "remote (deleted)"
+	}
+
+	for {
+		answer := util.CliQuestion(fmt.Sprintf("Keep %s (l) or %s (r) value?", local, remote))
+
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "l", "local":
+			return true
+		case "r", "remote":
+			return false
+		default:
+			fmt.Println("Please enter one of 'l', 'r', 'local', or 'remote'")
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package project
+
+import (
+	"sync"
+
+	"github.com/madwire-media/secrets-cli/types"
+)
+
+// DefaultJobs is the default number of secrets to prepare, fetch, or push at
+// once
+const DefaultJobs = 8
+
+// forEachParallel calls fn for every index from 0 to n-1, running at most jobs
+// calls at once. Once a call fails no new calls are started, and the error
+// with the lowest index is returned so errors are reported deterministically
+func forEachParallel(n int, jobs int, fn func(idx int) error) error {
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	errs := make([]error, n)
+	indexes := make(chan int)
+
+	var failed bool
+	var failedMutex sync.Mutex
+	var wg sync.WaitGroup
+
+	for worker := 0; worker < jobs && worker < n; worker++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for idx := range indexes {
+				failedMutex.Lock()
+				skip := failed
+				failedMutex.Unlock()
+
+				if skip {
+					continue
+				}
+
+				err := fn(idx)
+				if err != nil {
+					errs[idx] = err
+
+					failedMutex.Lock()
+					failed = true
+					failedMutex.Unlock()
+				}
+			}
+		}()
+	}
+
+	for idx := 0; idx < n; idx++ {
+		indexes <- idx
+	}
+
+	close(indexes)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// prepareAndFetch prepares every secret and then fetches every secret,
+// running at most jobs operations at once, and returns the fetched secrets in
+// the same order
+func prepareAndFetch(secrets []SecretConfig, jobs int) ([]types.FetchedSecret, error) {
+	err := forEachParallel(len(secrets), jobs, func(idx int) error {
+		return secrets[idx].Prepare()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	fetchedSecrets := make([]types.FetchedSecret, len(secrets))
+
+	err = forEachParallel(len(secrets), jobs, func(idx int) error {
+		fetchedSecret, err := secrets[idx].Fetch()
+		if err != nil {
+			return err
+		}
+
+		fetchedSecrets[idx] = fetchedSecret
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return fetchedSecrets, nil
+}
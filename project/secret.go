@@ -2,23 +2,110 @@ package project
 
 import (
 	"errors"
+	"fmt"
 
-	"github.com/madwire-media/secrets-cli/engines/vault"
+	"github.com/madwire-media/secrets-cli/engines"
 	"github.com/madwire-media/secrets-cli/types"
+	"gopkg.in/yaml.v3"
 )
 
 // SecretConfig is the format for any secret in the secrets.yaml config
 type SecretConfig struct {
-	File  string              `yaml:"file"`
-	Class *string             `yaml:"class,omitempty"`
-	Vault *vault.SecretConfig `yaml:"vault,omitempty"`
+	File   string
+	Class  *string
+	Engine engines.Engine
+}
+
+type secretConfigHeader struct {
+	File  string  `yaml:"file"`
+	Class *string `yaml:"class,omitempty"`
+}
+
+// UnmarshalYAML decodes the common secret fields, and then decodes the secret
+// engine config from whichever registered engine key is present. Any other key
+// is an error, so a typo in an engine key isn't silently ignored
+func (secretConfig *SecretConfig) UnmarshalYAML(value *yaml.Node) error {
+	var header secretConfigHeader
+
+	err := value.Decode(&header)
+	if err != nil {
+		return err
+	}
+
+	secretConfig.File = header.File
+	secretConfig.Class = header.Class
+	secretConfig.Engine = nil
+
+	if value.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	for i := 0; i+1 < len(value.Content); i += 2 {
+		key := value.Content[i].Value
+
+		if key == "file" || key == "class" {
+			continue
+		}
+
+		engine, ok := engines.New(key)
+		if !ok {
+			return fmt.Errorf("unknown key '%s' for secret '%s' on line %d", key, header.File, value.Content[i].Line)
+		}
+
+		if secretConfig.Engine != nil {
+			return fmt.Errorf("more than one secret engine defined for secret '%s'", header.File)
+		}
+
+		err = value.Content[i+1].Decode(engine)
+		if err != nil {
+			return err
+		}
+
+		secretConfig.Engine = engine
+	}
+
+	return nil
+}
+
+// MarshalYAML encodes the common secret fields followed by the secret engine
+// config under its registered engine key
+func (secretConfig SecretConfig) MarshalYAML() (interface{}, error) {
+	var node yaml.Node
+
+	err := node.Encode(secretConfigHeader{
+		File:  secretConfig.File,
+		Class: secretConfig.Class,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if secretConfig.Engine != nil {
+		key, err := engines.KeyOf(secretConfig.Engine)
+		if err != nil {
+			return nil, err
+		}
+
+		var keyNode, engineNode yaml.Node
+
+		keyNode.SetString(key)
+
+		err = engineNode.Encode(secretConfig.Engine)
+		if err != nil {
+			return nil, err
+		}
+
+		node.Content = append(node.Content, &keyNode, &engineNode)
+	}
+
+	return &node, nil
 }
 
 // Prepare prepares this secret for fetching, for example by getting auth
 // credentials from the user and generating a valid login session
 func (secretConfig *SecretConfig) Prepare() error {
-	if secretConfig.Vault != nil {
-		return secretConfig.Vault.Prepare()
+	if secretConfig.Engine != nil {
+		return secretConfig.Engine.Prepare()
 	}
 
 	return errors.New("no secret engine defined for secret")
@@ -27,9 +114,29 @@ func (secretConfig *SecretConfig) Prepare() error {
 // Fetch fetches this secret from the remote server, returning an interface
 // capable of uploading a new version of this secret as well
 func (secretConfig *SecretConfig) Fetch() (types.FetchedSecret, error) {
-	if secretConfig.Vault != nil {
-		return secretConfig.Vault.Fetch()
+	if secretConfig.Engine != nil {
+		return secretConfig.Engine.Fetch()
 	}
 
 	return nil, errors.New("no secret engine defined for secret")
 }
+
+// Describe returns where this secret is stored, or an empty string if it has
+// no secret engine
+func (secretConfig *SecretConfig) Describe() string {
+	if secretConfig.Engine != nil {
+		return secretConfig.Engine.Describe()
+	}
+
+	return ""
+}
+
+// IsDynamic returns true if fetching this secret issues a brand new secret,
+// like a dynamic secret from Vault
+func (secretConfig *SecretConfig) IsDynamic() bool {
+	if dynamic, ok := secretConfig.Engine.(engines.DynamicEngine); ok {
+		return dynamic.IsDynamic()
+	}
+
+	return false
+}
@@ -0,0 +1,247 @@
+package project
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/madwire-media/secrets-cli/types"
+	"github.com/madwire-media/secrets-cli/util"
+	"github.com/madwire-media/secrets-cli/vars"
+)
+
+// States of a secret file as reported by Status
+const (
+	StateInSync         = "in sync"
+	StateLocalModified  = "local modified"
+	StateRemoteModified = "remote modified"
+	StateConflict       = "conflict"
+	StateMissingLocal   = "missing local"
+	StateMissingRemote  = "missing remote"
+	StateUnparseable    = "unparseable"
+	StateUnreferenced   = "unreferenced"
+)
+
+// SecretStatus is the state of a single secret file, with the filename
+// relative to the working directory
+type SecretStatus struct {
+	File  string `json:"file"`
+	State string `json:"state"`
+}
+
+// InSync returns true if the secret file doesn't need to be synced
+func (status *SecretStatus) InSync() bool {
+	return status.State == StateInSync
+}
+
+// Status fetches every secret and does the same 3-way diff as Sync between the
+// local files, the local lock file, and the remote secrets, but only reports
+// the state of every secret file without changing anything. Dynamic secrets
+// are never fetched since that would issue a new secret. At most jobs secrets
+// are prepared or fetched at once
+func (project *Project) Status(jobs int) ([]SecretStatus, error) {
+	secrets, excludedSecrets := filterSecrets(project.Secrets, project.classes)
+
+	secrets, leasedSecrets, err := project.filterLeasedSecrets(secrets)
+	if err != nil {
+		return nil, err
+	}
+
+	fetchSecrets, dynamicSecrets := splitDynamicSecrets(secrets)
+
+	fetchedSecrets, err := prepareAndFetch(fetchSecrets, jobs)
+	if err != nil {
+		return nil, err
+	}
+
+	err = project.computeCurrentState(fetchSecrets, fetchedSecrets)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make(map[string]string)
+
+	for idx, secret := range fetchSecrets {
+		diff, err := project.diffSecret(secret, fetchedSecrets[idx])
+		if err != nil {
+			return nil, err
+		}
+
+		states[secret.File] = diff.state()
+	}
+
+	for _, secret := range leasedSecrets {
+		states[secret.File] = StateInSync
+	}
+
+	for _, secret := range dynamicSecrets {
+		// A new secret will be issued on the next sync either way
+		if fileExists(filepath.Join(project.path, secret.File)) {
+			states[secret.File] = StateRemoteModified
+		} else {
+			states[secret.File] = StateMissingLocal
+		}
+	}
+
+	statuses := []SecretStatus{}
+
+	// Report secrets in the order they're configured
+	for _, secret := range project.Secrets {
+		state, ok := states[secret.File]
+		if !ok {
+			continue
+		}
+
+		relativeFilename, err := project.relativeFilename(secret.File)
+		if err != nil {
+			return nil, err
+		}
+
+		statuses = append(statuses, SecretStatus{
+			File:  relativeFilename,
+			State: state,
+		})
+	}
+
+	unreferencedFiles := []string{}
+
+	for _, secret := range excludedSecrets {
+		unreferencedFiles = append(unreferencedFiles, secret.File)
+	}
+
+	for filename := range project.lastState.Files {
+		if !project.isConfigured(filename) {
+			unreferencedFiles = append(unreferencedFiles, filename)
+		}
+	}
+
+	for _, filename := range unreferencedFiles {
+		if !fileExists(filepath.Join(project.path, filename)) {
+			continue
+		}
+
+		relativeFilename, err := project.relativeFilename(filename)
+		if err != nil {
+			return nil, err
+		}
+
+		statuses = append(statuses, SecretStatus{
+			File:  relativeFilename,
+			State: StateUnreferenced,
+		})
+	}
+
+	return statuses, nil
+}
+
+// secretDiff is how a fetched secret compares to its local file and its last
+// synced state in the lockfile. Sync decides what to do with a secret based on
+// it, and Status reports it, so the two always agree
+type secretDiff int
+
+const (
+	diffMissingBoth secretDiff = iota
+	diffMissingLocal
+	diffMissingRemote
+	diffUnparseable
+	diffInSync
+	diffWrongFormat
+	diffNewFile
+	diffBothModified
+	diffRemoteModified
+	diffLocalModified
+	diffCorruptLock
+)
+
+// diffSecret does the 3-way diff between a fetched secret, its local file, and
+// its last synced state
+func (project *Project) diffSecret(secret SecretConfig, fetchedSecret types.FetchedSecret) (secretDiff, error) {
+	fileState := project.currentState.Files[secret.File]
+	prevState, hasPrevState := project.lastState.Files[secret.File]
+
+	if fileState.LocalHash == "" && fileState.formatError == nil {
+		// The file doesn't exist
+
+		if fetchedSecret.IsMissingData() {
+			return diffMissingBoth, nil
+		}
+
+		return diffMissingLocal, nil
+	} else if fetchedSecret.IsMissingData() {
+		return diffMissingRemote, nil
+	} else if fileState.formatError != nil {
+		return diffUnparseable, nil
+	}
+
+	remoteHash, err := hashValue(fetchedSecret.Value())
+	if err != nil {
+		return 0, err
+	}
+
+	if fileState.LocalHash == remoteHash {
+		if util.NameToFormat(fileState.LocalFormat) != fetchedSecret.Format() {
+			return diffWrongFormat, nil
+		}
+
+		return diffInSync, nil
+	}
+
+	if !hasPrevState {
+		return diffNewFile, nil
+	}
+
+	remoteChanged := fetchedSecret.Version() != prevState.RemoteVersion
+	localChanged := fileState.LocalHash != prevState.LocalHash
+
+	if remoteChanged && localChanged {
+		return diffBothModified, nil
+	} else if remoteChanged {
+		return diffRemoteModified, nil
+	} else if localChanged {
+		return diffLocalModified, nil
+	}
+
+	// Neither changed, but the file doesn't match the remote secret
+	return diffCorruptLock, nil
+}
+
+// state returns the state Status reports for a diff
+func (diff secretDiff) state() string {
+	switch diff {
+	case diffMissingBoth, diffMissingRemote:
+		return StateMissingRemote
+	case diffMissingLocal:
+		return StateMissingLocal
+	case diffUnparseable:
+		return StateUnparseable
+	case diffInSync:
+		return StateInSync
+	case diffWrongFormat:
+		// Same data but in a different format, which sync will rewrite
+		return StateRemoteModified
+	case diffRemoteModified:
+		return StateRemoteModified
+	case diffLocalModified:
+		return StateLocalModified
+	default:
+		return StateConflict
+	}
+}
+
+func (project *Project) isConfigured(filename string) bool {
+	for _, secret := range project.Secrets {
+		if secret.File == filename {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (project *Project) relativeFilename(filename string) (string, error) {
+	return filepath.Rel(vars.Workdir, filepath.Join(project.path, filename))
+}
+
+func fileExists(filename string) bool {
+	_, err := os.Stat(filename)
+	return err == nil
+}
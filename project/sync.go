@@ -19,44 +19,104 @@ type SyncOptions struct {
 	PullOnly     bool
 	PushOnly     bool
 	FixByDefault bool
+	DryRun       bool
+	Jobs         int
 	Classes      ClassUpdate
 }
 
+// pendingPush is a secret that was chosen to be pushed during a sync. Pushes
+// are queued up so they can be run concurrently once every decision is made,
+// and event is the index of the secret's event to update with the result
+type pendingPush struct {
+	secret        SecretConfig
+	fetchedSecret types.FetchedSecret
+	event         int
+}
+
 // Sync prepares every secret, fetches every secret, and does a 3-way diff
 // between the local files, the local lock file, and the remote secrets,
-// pulling or pushing secrets where relevant
+// pulling or pushing secrets where relevant. In dry-run mode nothing is
+// changed, and every action is printed instead
 func (project *Project) Sync(options SyncOptions) error {
 	if options.PullOnly && options.PushOnly {
 		return errors.New("--pull flag and --push flag cannot both be enabled")
 	}
 
+	project.dryRun = options.DryRun
+	project.events = []SyncEvent{}
+
 	project.applyClassUpdate(options.Classes)
 
 	secrets, excludedSecrets := filterSecrets(project.Secrets, project.classes)
 
-	for _, secret := range secrets {
-		err := secret.Prepare()
+	secrets, leasedSecrets, err := project.filterLeasedSecrets(secrets)
+	if err != nil {
+		return err
+	}
+
+	var dynamicSecrets []SecretConfig
+
+	if project.dryRun {
+		// Fetching a dynamic secret issues a new one, so leave them alone
+		secrets, dynamicSecrets = splitDynamicSecrets(secrets)
+	}
+
+	fetchedSecrets, err := prepareAndFetch(secrets, options.Jobs)
+	if err != nil {
+		return err
+	}
+
+	err = project.computeCurrentState(secrets, fetchedSecrets)
+	if err != nil {
+		return err
+	}
+
+	for _, secret := range leasedSecrets {
+		prevState := project.lastState.Files[secret.File]
+
+		correctedFilename := filepath.Join(project.path, secret.File)
+		relativeFilename, err := filepath.Rel(vars.Workdir, correctedFilename)
 		if err != nil {
 			return err
 		}
-	}
 
-	fetchedSecrets := make([]types.FetchedSecret, len(secrets))
+		util.Log.Infof("Dynamic secret '%s' is still valid (%s)", relativeFilename, formatLeaseExpiry(prevState.Lease))
 
-	for idx, secret := range secrets {
-		fetchedSecret, err := secret.Fetch()
+		project.currentState.Files[secret.File] = prevState
+		project.events = append(project.events, SyncEvent{
+			File:       relativeFilename,
+			Action:     ActionUnchanged,
+			Reason:     ReasonValidLease,
+			OldVersion: prevState.RemoteVersion,
+			NewVersion: prevState.RemoteVersion,
+		})
+	}
+
+	for _, secret := range dynamicSecrets {
+		relativeFilename, err := project.relativeFilename(secret.File)
 		if err != nil {
 			return err
 		}
 
-		fetchedSecrets[idx] = fetchedSecret
-	}
+		util.Log.Infof("Issuing new dynamic secret for '%s'", relativeFilename)
+		project.printResult("done", "issue")
 
-	err := project.computeCurrentState(secrets, fetchedSecrets)
-	if err != nil {
-		return err
+		event := SyncEvent{
+			File:   relativeFilename,
+			Action: ActionPulled,
+			Reason: ReasonDynamicSecret,
+		}
+
+		if prevState, hasPrevState := project.lastState.Files[secret.File]; hasPrevState {
+			project.currentState.Files[secret.File] = prevState
+			event.OldVersion = prevState.RemoteVersion
+		}
+
+		project.events = append(project.events, event)
 	}
 
+	pushes := []pendingPush{}
+
 	for idx, secret := range secrets {
 		fetchedSecret := fetchedSecrets[idx]
 		fileState := project.currentState.Files[secret.File]
@@ -68,119 +128,172 @@ func (project *Project) Sync(options SyncOptions) error {
 			return err
 		}
 
-		remoteHash, err := hashValue(fetchedSecret.Value())
-		if err != nil {
-			return err
+		// Secrets are skipped unless one of the cases below does something
+		event := SyncEvent{
+			File:       relativeFilename,
+			Action:     ActionSkipped,
+			NewVersion: fetchedSecret.Version(),
+		}
+
+		if hasPrevState {
+			event.OldVersion = prevState.RemoteVersion
 		}
 
-		if fileState.LocalHash == "" && fileState.formatError == nil {
-			// The file doesn't exist
+		if lease := leaseOf(fetchedSecret); lease != nil {
+			// Dynamic secrets are issued fresh on every fetch and can only be
+			// pulled
+
+			event.Reason = ReasonDynamicSecret
 
 			if fetchedSecret.IsMissingData() {
-				// Neither remote secret nor local file exist
+				return fmt.Errorf("dynamic secret for '%s' is missing data", relativeFilename)
+			}
 
-				fmt.Printf("No local file or remote data for secret '%s'\n", relativeFilename)
+			if hasPrevState && fileState.LocalHash != prevState.LocalHash {
+				util.Log.Infof("Overwriting modified dynamic secret file '%s' with newly issued secret (%s)", relativeFilename, formatLeaseExpiry(lease))
 			} else {
-				// Remote secret exists, but local file doesn't
+				util.Log.Infof("Writing newly issued dynamic secret to '%s' (%s)", relativeFilename, formatLeaseExpiry(lease))
+			}
 
-				fmt.Printf("Writing new secret to '%s'\n", relativeFilename)
+			err := project.pullSecret(secret, fetchedSecret, &fileState)
+			if err != nil {
+				return err
+			}
 
-				err := project.pullSecret(secret, fetchedSecret, &fileState)
-				if err != nil {
-					return err
-				}
+			fileState.Lease = lease
+			project.currentState.Files[secret.File] = fileState
+
+			event.Action = ActionPulled
+			project.printResult("done", "pull")
+			project.events = append(project.events, event)
+			continue
+		}
+
+		diff, err := project.diffSecret(secret, fetchedSecret)
+		if err != nil {
+			return err
+		}
+
+		switch diff {
+		case diffMissingBoth:
+			// Neither remote secret nor local file exist
+
+			event.Reason = StateMissingRemote
+			event.Action = ActionUnchanged
+
+			util.Log.Infof("No local file or remote data for secret '%s'", relativeFilename)
 
-				fmt.Println("    done")
+		case diffMissingLocal:
+			// Remote secret exists, but local file doesn't
+
+			event.Reason = StateMissingLocal
+
+			util.Log.Infof("Writing new secret to '%s'", relativeFilename)
+
+			err := project.pullSecret(secret, fetchedSecret, &fileState)
+			if err != nil {
+				return err
 			}
-		} else if fetchedSecret.IsMissingData() {
+
+			event.Action = ActionPulled
+			project.printResult("done", "pull")
+
+		case diffMissingRemote:
 			// File exists but remote secret does not
 
+			event.Reason = StateMissingRemote
+
 			shouldPush := false
 
 			if vars.IsCICD {
 				return fmt.Errorf("remote secret for '%s' does not exist or is missing data", relativeFilename)
 			} else if options.FixByDefault {
-				fmt.Printf("Pushing secret '%s' because remote secret is incomplete or does not exist (--fix flag is enabled)\n", relativeFilename)
+				util.Log.Infof("Pushing secret '%s' because remote secret is incomplete or does not exist (--fix flag is enabled)", relativeFilename)
 				shouldPush = true
-			} else if !vars.IsTTY {
-				fmt.Printf("Remote secret for '%s' is incomplete or does not exist, use the --fix flag to fix it\n", relativeFilename)
+			} else if !project.isInteractive() {
+				util.Log.Warnf("remote secret for '%s' is incomplete or does not exist, use the --fix flag to fix it", relativeFilename)
 			} else {
 				fmt.Printf("Remote secret for '%s' is incomplete or does not exist, do you want to push it?\n", relativeFilename)
 				shouldPush = util.CliQuestionYesNoDefault("Push secret?", true)
 			}
 
 			if shouldPush {
-				err := project.pushSecret(fetchedSecret, &fileState)
+				pushes = append(pushes, pendingPush{secret, fetchedSecret, len(project.events)})
+				event.Action = ActionPushed
+				event.NewVersion = nil
+				project.printResult("queued", "push")
+			} else {
+				util.Log.Info("    skipped")
+			}
+
+		case diffWrongFormat:
+			// File contents match remote secret, but not in the expected format
+
+			event.Reason = ReasonWrongFormat
+
+			shouldPull := false
+
+			if hasPrevState && prevState.LocalFormat == fileState.LocalFormat {
+				util.Log.Infof("Updating secret '%s' to newer format", relativeFilename)
+				shouldPull = true
+			} else if vars.IsCICD {
+				util.Log.Infof("Updating secret '%s' to correct format (--cicd flag is enabled)", relativeFilename)
+				shouldPull = true
+			} else if options.FixByDefault {
+				util.Log.Infof("Updating secret '%s' to correct format (--fix flag is enabled)", relativeFilename)
+				shouldPull = true
+			} else if !project.isInteractive() {
+				util.Log.Warnf("secret '%s' has the same data but in a different format, use the --fix flag to fix it", relativeFilename)
+			} else {
+				fmt.Printf("Secret '%s' has the same data but in a different format, do you want to fix it?", relativeFilename)
+				shouldPull = util.CliQuestionYesNoDefault("Fix format?", true)
+			}
+
+			if shouldPull {
+				err := project.pullSecret(secret, fetchedSecret, &fileState)
 				if err != nil {
 					return err
 				}
 
-				fmt.Println("    done")
+				event.Action = ActionPulled
+				project.printResult("done", "pull")
 			} else {
-				fmt.Println("    skipped")
+				util.Log.Info("    skipped")
 			}
-		} else if fileState.LocalHash == remoteHash {
+
+		case diffInSync:
 			// File exists and contents match existing secret
 
-			if util.NameToFormat(fileState.LocalFormat) != fetchedSecret.Format() {
-				// Local file format does not match expected format
-
-				shouldPull := false
-
-				if hasPrevState && prevState.LocalFormat == fileState.LocalFormat {
-					fmt.Printf("Updating secret '%s' to newer format\n", relativeFilename)
-					shouldPull = true
-				} else if vars.IsCICD {
-					fmt.Printf("Updating secret '%s' to correct format (--cicd flag is enabled)\n", relativeFilename)
-					shouldPull = true
-				} else if options.FixByDefault {
-					fmt.Printf("Updating secret '%s' to correct format (--fix flag is enabled)\n", relativeFilename)
-					shouldPull = true
-				} else if !vars.IsTTY {
-					fmt.Printf("Secret '%s' has the same data but in a different format, use the --fix flag to fix it\n", relativeFilename)
-				} else {
-					fmt.Printf("Secret '%s' has the same data but in a different format, do you want to fix it?", relativeFilename)
-					shouldPull = util.CliQuestionYesNoDefault("Fix format?", true)
-				}
+			event.Reason = StateInSync
+			event.Action = ActionUnchanged
 
-				if shouldPull {
-					err := project.pullSecret(secret, fetchedSecret, &fileState)
-					if err != nil {
-						return err
-					}
-
-					fmt.Println("    done")
-				} else {
-					fmt.Println("    skipped")
+			if hasPrevState {
+				if prevState.RemoteVersion != fileState.RemoteVersion {
+					util.Log.Debugf("remote version for '%s' changed but is already in sync", relativeFilename)
 				}
-			} else {
-				// Local file format is correct
 
-				if hasPrevState {
-					if prevState.RemoteVersion != fileState.RemoteVersion {
-						fmt.Printf("info: remote version for '%s' changed but is already in sync\n", relativeFilename)
-					}
-
-					if prevState.LocalHash != fileState.LocalHash {
-						fmt.Printf("info: local secret '%s' contents changed but is already in sync\n", relativeFilename)
-					}
+				if prevState.LocalHash != fileState.LocalHash {
+					util.Log.Debugf("local secret '%s' contents changed but is already in sync", relativeFilename)
 				}
-
-				fmt.Printf("Secret '%s' is already up to date\n", relativeFilename)
 			}
-		} else if fileState.LocalHash == "" && fileState.formatError != nil {
+
+			util.Log.Infof("Secret '%s' is already up to date", relativeFilename)
+
+		case diffUnparseable:
 			// File exists but couldn't be parsed
 
+			event.Reason = StateUnparseable
+
 			shouldPull := false
 
 			if vars.IsCICD {
-				fmt.Printf("Overwriting secret that failed parsing '%s' (--cicd flag is enabled)\n", relativeFilename)
+				util.Log.Infof("Overwriting secret that failed parsing '%s' (--cicd flag is enabled)", relativeFilename)
 				shouldPull = true
 			} else if options.FixByDefault {
-				fmt.Printf("Overwriting secret that failed parsing '%s' (--fix flag is enabled)\n", relativeFilename)
+				util.Log.Infof("Overwriting secret that failed parsing '%s' (--fix flag is enabled)", relativeFilename)
 				shouldPull = true
-			} else if !vars.IsTTY {
-				fmt.Printf("Failed to parse secret '%s', use the --fix flag to fix it\n", relativeFilename)
+			} else if !project.isInteractive() {
+				util.Log.Warnf("failed to parse secret '%s', use the --fix flag to fix it", relativeFilename)
 			} else {
 				fmt.Printf("Failed to parse secret '%s', do you want to fix it?", relativeFilename)
 				shouldPull = util.CliQuestionYesNoDefault("Overwrite file?", true)
@@ -192,185 +305,222 @@ func (project *Project) Sync(options SyncOptions) error {
 					return err
 				}
 
-				fmt.Println("    done")
+				event.Action = ActionPulled
+				project.printResult("done", "pull")
 			} else {
-				fmt.Println("    skipped")
+				util.Log.Info("    skipped")
 			}
-		} else {
-			// File exists but doesn't match remote secret
 
-			if !hasPrevState {
-				// File exists, doesn't match remote secret, and isn't in lockfile
+		case diffNewFile:
+			// File exists, doesn't match remote secret, and isn't in lockfile
 
-				shouldPush := false
-				shouldPull := false
-
-				if vars.IsCICD {
-					fmt.Printf("Overwriting new secret file '%s' with remote copy (--cicd flag is enabled)\n", relativeFilename)
-					shouldPull = true
-				} else if options.PullOnly {
-					fmt.Printf("Overwiting new secret file '%s' with remote copy (--pull flag is enabled)\n", relativeFilename)
-					shouldPull = true
-				} else if options.PushOnly {
-					fmt.Printf("Overwriting new remote secret with local copy '%s' (--push flag is enabled)\n", relativeFilename)
-					shouldPush = true
-				} else if !vars.IsTTY {
-					fmt.Printf("New secret file '%s' does not match remote copy\n", relativeFilename)
-				} else {
-					fmt.Printf("New secret file '%s' does not match remote copy, do you want to pull, push, or leave it as is?\n", relativeFilename)
-					shouldPush, shouldPull = cliQuestionPushPull()
-				}
+			event.Reason = StateConflict
 
-				if shouldPush {
-					err = project.pushSecret(fetchedSecret, &fileState)
-					if err != nil {
-						return err
-					}
+			shouldPush := false
+			shouldPull := false
 
-					fmt.Println("    pushed")
-				} else if shouldPull {
-					err := project.pullSecret(secret, fetchedSecret, &fileState)
-					if err != nil {
-						return err
-					}
+			if vars.IsCICD {
+				util.Log.Infof("Overwriting new secret file '%s' with remote copy (--cicd flag is enabled)", relativeFilename)
+				shouldPull = true
+			} else if options.PullOnly {
+				util.Log.Infof("Overwiting new secret file '%s' with remote copy (--pull flag is enabled)", relativeFilename)
+				shouldPull = true
+			} else if options.PushOnly {
+				util.Log.Infof("Overwriting new remote secret with local copy '%s' (--push flag is enabled)", relativeFilename)
+				shouldPush = true
+			} else if !project.isInteractive() {
+				util.Log.Warnf("new secret file '%s' does not match remote copy", relativeFilename)
+			} else {
+				fmt.Printf("New secret file '%s' does not match remote copy, do you want to pull, push, or leave it as is?\n", relativeFilename)
+				shouldPush, shouldPull = cliQuestionPushPull()
+			}
 
-					fmt.Println("    pulled")
-				} else {
-					fmt.Println("    skipped")
+			if shouldPush {
+				pushes = append(pushes, pendingPush{secret, fetchedSecret, len(project.events)})
+				event.Action = ActionPushed
+				event.NewVersion = nil
+				project.printResult("queued", "push")
+			} else if shouldPull {
+				err := project.pullSecret(secret, fetchedSecret, &fileState)
+				if err != nil {
+					return err
 				}
+
+				event.Action = ActionPulled
+				project.printResult("pulled", "pull")
 			} else {
-				// File exists, doesn't match remote secret, and has record in lockfile
-
-				if fetchedSecret.Version() != prevState.RemoteVersion {
-					// Remote version changed
-
-					if fileState.LocalHash != prevState.LocalHash {
-						// Local version changed too
-
-						shouldPush := false
-						shouldPull := false
-
-						if vars.IsCICD {
-							fmt.Printf("Overwriting modified secret file '%s' with remote copy (--cicd flag is enabled)\n", relativeFilename)
-							shouldPull = true
-						} else if options.PullOnly {
-							fmt.Printf("Overwiting modified secret file '%s' with remote copy (--pull flag is enabled)\n", relativeFilename)
-							shouldPull = true
-						} else if options.PushOnly {
-							fmt.Printf("Overwriting remote secret with modified local copy '%s' (--push flag is enabled)\n", relativeFilename)
-							shouldPush = true
-						} else if !vars.IsTTY {
-							fmt.Printf("Modified secret file '%s' does not match modified remote copy\n", relativeFilename)
-						} else {
-							fmt.Printf("Modified secret file '%s' does not match modified remote copy, do you want to pull, push, or leave it as is?\n", relativeFilename)
-							shouldPush, shouldPull = cliQuestionPushPull()
-						}
+				util.Log.Info("    skipped")
+			}
 
-						if shouldPush {
-							err = project.pushSecret(fetchedSecret, &fileState)
-							if err != nil {
-								return err
-							}
-
-							fmt.Println("    pushed")
-						} else if shouldPull {
-							err := project.pullSecret(secret, fetchedSecret, &fileState)
-							if err != nil {
-								return err
-							}
-
-							fmt.Println("    pulled")
-						} else {
-							fmt.Println("    skipped")
-						}
-					} else {
-						// Only the remote version changed
+		case diffBothModified:
+			// Remote and local versions both changed
 
-						shouldPull := true
+			event.Reason = StateConflict
 
-						if options.PushOnly {
-							fmt.Printf("Not pulling modifed remote secret to local file '%s' (--push flag is enabled)\n", relativeFilename)
-							shouldPull = false
-						}
+			shouldPush := false
+			shouldPull := false
+			merged := false
+
+			if vars.IsCICD {
+				util.Log.Infof("Overwriting modified secret file '%s' with remote copy (--cicd flag is enabled)", relativeFilename)
+				shouldPull = true
+			} else if options.PullOnly {
+				util.Log.Infof("Overwiting modified secret file '%s' with remote copy (--pull flag is enabled)", relativeFilename)
+				shouldPull = true
+			} else if options.PushOnly {
+				util.Log.Infof("Overwriting remote secret with modified local copy '%s' (--push flag is enabled)", relativeFilename)
+				shouldPush = true
+			} else {
+				merged, err = project.mergeSecret(secret, fetchedSecret, &fileState, prevState, relativeFilename)
+				if err != nil {
+					return err
+				}
 
-						if shouldPull {
-							fmt.Printf("Pulling new version of secret '%s'\n", relativeFilename)
+				if !merged && !project.isInteractive() {
+					util.Log.Warnf("modified secret file '%s' does not match modified remote copy", relativeFilename)
+				} else if !merged {
+					fmt.Printf("Modified secret file '%s' does not match modified remote copy, do you want to pull, push, merge, or leave it as is?\n", relativeFilename)
 
-							err := project.pullSecret(secret, fetchedSecret, &fileState)
-							if err != nil {
-								return err
-							}
+					shouldMerge := false
+					shouldPush, shouldPull, shouldMerge = cliQuestionPushPullMerge()
 
-							fmt.Println("    done")
+					if shouldMerge {
+						merged, err = project.mergeSecretWithTool(secret, fetchedSecret, &fileState, prevState, relativeFilename)
+						if err != nil {
+							return err
 						}
 					}
-				} else {
-					// Remote version didn't change
+				}
+			}
 
-					if fileState.LocalHash != prevState.LocalHash {
-						// Only the local version changed
+			if merged {
+				util.Log.Infof("Merged modified secret file '%s' with modified remote copy", relativeFilename)
 
-						shouldPush := true
+				remoteHash, err := hashValue(fetchedSecret.Value())
+				if err != nil {
+					return err
+				}
 
-						if vars.IsCICD {
-							fmt.Printf("Not pushing modified secret file '%s' (--cicd flag is enabled)\n", relativeFilename)
-							shouldPush = false
-						} else if options.PullOnly {
-							fmt.Printf("Not pushing modified secret file '%s' (--pull flag is enabled)\n", relativeFilename)
-							shouldPush = false
-						}
+				// Only push if the merge kept any local changes
+				shouldPush = fileState.LocalHash != remoteHash
+				if !shouldPush {
+					event.Action = ActionPulled
+					project.printResult("done", "merge")
+				}
+			}
 
-						if shouldPush {
-							fmt.Printf("Pushing new version of secret '%s'\n", relativeFilename)
+			if shouldPush {
+				pushes = append(pushes, pendingPush{secret, fetchedSecret, len(project.events)})
+				event.Action = ActionPushed
+				event.NewVersion = nil
+				project.printResult("queued", "push")
+			} else if shouldPull {
+				err := project.pullSecret(secret, fetchedSecret, &fileState)
+				if err != nil {
+					return err
+				}
 
-							err := project.pushSecret(fetchedSecret, &fileState)
-							if err != nil {
-								return err
-							}
+				event.Action = ActionPulled
+				project.printResult("pulled", "pull")
+			} else if !merged {
+				// Keep the last synced state so the conflict can still be
+				// merged on the next sync
+				fileState = prevState
+				fileState.Lease = nil
 
-							fmt.Println("    done")
-						}
-					} else {
-						// Neither version changed, lockfile is corrupt
-
-						shouldPush := false
-						shouldPull := false
-
-						if vars.IsCICD {
-							fmt.Printf("Lockfile is corrupt, overwriting secret file '%s' with remote copy (--cicd flag is enabled)\n", relativeFilename)
-							shouldPull = true
-						} else if !vars.IsTTY {
-							fmt.Printf("Lockfile is corrupt, secret file '%s' does not match remote copy but neither are modified\n", relativeFilename)
-						} else {
-							fmt.Printf("Lockfile is corrupt, secret file '%s' does not match remote copy, do you want to pull, push, or leave it as is?\n", relativeFilename)
-							shouldPush, shouldPull = cliQuestionPushPull()
-						}
+				util.Log.Info("    skipped")
+			}
 
-						if shouldPush {
-							err = project.pushSecret(fetchedSecret, &fileState)
-							if err != nil {
-								return err
-							}
-
-							fmt.Println("    pushed")
-						} else if shouldPull {
-							err := project.pullSecret(secret, fetchedSecret, &fileState)
-							if err != nil {
-								return err
-							}
-
-							fmt.Println("    pulled")
-						} else {
-							fmt.Println("    skipped")
-						}
-					}
+		case diffRemoteModified:
+			// Only the remote version changed
+
+			event.Reason = StateRemoteModified
+
+			shouldPull := true
+
+			if options.PushOnly {
+				util.Log.Infof("Not pulling modifed remote secret to local file '%s' (--push flag is enabled)", relativeFilename)
+				shouldPull = false
+			}
+
+			if shouldPull {
+				util.Log.Infof("Pulling new version of secret '%s'", relativeFilename)
+
+				err := project.pullSecret(secret, fetchedSecret, &fileState)
+				if err != nil {
+					return err
+				}
+
+				event.Action = ActionPulled
+				project.printResult("done", "pull")
+			}
+
+		case diffLocalModified:
+			// Only the local version changed
+
+			event.Reason = StateLocalModified
+
+			shouldPush := true
+
+			if vars.IsCICD {
+				util.Log.Infof("Not pushing modified secret file '%s' (--cicd flag is enabled)", relativeFilename)
+				shouldPush = false
+			} else if options.PullOnly {
+				util.Log.Infof("Not pushing modified secret file '%s' (--pull flag is enabled)", relativeFilename)
+				shouldPush = false
+			}
+
+			if shouldPush {
+				util.Log.Infof("Pushing new version of secret '%s'", relativeFilename)
+
+				pushes = append(pushes, pendingPush{secret, fetchedSecret, len(project.events)})
+				event.Action = ActionPushed
+				event.NewVersion = nil
+				project.printResult("queued", "push")
+			}
+
+		case diffCorruptLock:
+			// Neither version changed, lockfile is corrupt
+
+			event.Reason = ReasonCorruptLock
+
+			shouldPush := false
+			shouldPull := false
+
+			if vars.IsCICD {
+				util.Log.Infof("Lockfile is corrupt, overwriting secret file '%s' with remote copy (--cicd flag is enabled)", relativeFilename)
+				shouldPull = true
+			} else if !project.isInteractive() {
+				util.Log.Warnf("lockfile is corrupt, secret file '%s' does not match remote copy but neither are modified", relativeFilename)
+			} else {
+				fmt.Printf("Lockfile is corrupt, secret file '%s' does not match remote copy, do you want to pull, push, or leave it as is?\n", relativeFilename)
+				shouldPush, shouldPull = cliQuestionPushPull()
+			}
+
+			if shouldPush {
+				pushes = append(pushes, pendingPush{secret, fetchedSecret, len(project.events)})
+				event.Action = ActionPushed
+				event.NewVersion = nil
+				project.printResult("queued", "push")
+			} else if shouldPull {
+				err := project.pullSecret(secret, fetchedSecret, &fileState)
+				if err != nil {
+					return err
 				}
+
+				event.Action = ActionPulled
+				project.printResult("pulled", "pull")
+			} else {
+				util.Log.Info("    skipped")
 			}
 		}
 
 		project.currentState.Files[secret.File] = fileState
+		project.events = append(project.events, event)
 	}
 
+	pushErr := project.runPushes(pushes, options.Jobs)
+
 	for _, secret := range excludedSecrets {
 		correctedFilename := filepath.Join(project.path, secret.File)
 		relativeFilename, err := filepath.Rel(vars.Workdir, correctedFilename)
@@ -383,11 +533,16 @@ func (project *Project) Sync(options SyncOptions) error {
 		if err == nil {
 			var shouldDeleteFile bool
 
+			event := SyncEvent{
+				File:   relativeFilename,
+				Reason: StateUnreferenced,
+			}
+
 			if vars.IsCICD {
-				fmt.Printf("Deleting unreferenced secret file at '%s' (--cicd flag is enabled)\n", relativeFilename)
+				util.Log.Infof("Deleting unreferenced secret file at '%s' (--cicd flag is enabled)", relativeFilename)
 				shouldDeleteFile = true
-			} else if !vars.IsTTY {
-				fmt.Printf("Warning: unreferenced secret file at '%s'\n", relativeFilename)
+			} else if !project.isInteractive() {
+				util.Log.Warnf("unreferenced secret file at '%s'", relativeFilename)
 				shouldDeleteFile = false
 			} else {
 				fmt.Printf("Unreferenced file at %s, would you like to remove it?\n", relativeFilename)
@@ -395,15 +550,19 @@ func (project *Project) Sync(options SyncOptions) error {
 			}
 
 			if shouldDeleteFile {
-				err := os.Remove(correctedFilename)
+				err := project.removeFile(correctedFilename)
 				if err != nil {
 					return err
 				}
 
-				fmt.Println("    deleted")
+				event.Action = ActionDeleted
+				project.printResult("deleted", "delete")
 			} else {
-				fmt.Println("    skipped")
+				event.Action = ActionSkipped
+				util.Log.Info("    skipped")
 			}
+
+			project.events = append(project.events, event)
 		}
 	}
 
@@ -420,11 +579,17 @@ func (project *Project) Sync(options SyncOptions) error {
 			if err == nil {
 				var shouldDeleteFile bool
 
+				event := SyncEvent{
+					File:       relativeFilename,
+					Reason:     ReasonRemoved,
+					OldVersion: project.lastState.Files[filename].RemoteVersion,
+				}
+
 				if vars.IsCICD {
-					fmt.Printf("Deleting removed secret file at '%s' (--cicd flag is enabled)\n", relativeFilename)
+					util.Log.Infof("Deleting removed secret file at '%s' (--cicd flag is enabled)", relativeFilename)
 					shouldDeleteFile = true
-				} else if !vars.IsTTY {
-					fmt.Printf("Warning: removed secret file at '%s'\n", relativeFilename)
+				} else if !project.isInteractive() {
+					util.Log.Warnf("removed secret file at '%s'", relativeFilename)
 					shouldDeleteFile = false
 				} else {
 					fmt.Printf("Removed file at %s, would you like to remove it?\n", relativeFilename)
@@ -432,24 +597,142 @@ func (project *Project) Sync(options SyncOptions) error {
 				}
 
 				if shouldDeleteFile {
-					err := os.Remove(correctedFilename)
+					err := project.removeFile(correctedFilename)
 					if err != nil {
 						return err
 					}
 
-					fmt.Println("    deleted")
+					event.Action = ActionDeleted
+					project.printResult("deleted", "delete")
 				} else {
-					fmt.Println("    skipped")
+					event.Action = ActionSkipped
+					util.Log.Info("    skipped")
 				}
+
+				project.events = append(project.events, event)
 			}
 		}
 	}
 
+	if project.dryRun {
+		changed, err := project.currentStateChanged()
+		if err != nil {
+			return err
+		}
+
+		if changed {
+			util.Log.Info("Would update secrets.lock")
+		}
+
+		return nil
+	}
+
 	err = project.saveCurrentState()
 	if err != nil {
 		return err
 	}
 
+	// Failed pushes keep their previous state in the lockfile, so they show up
+	// as local modifications and get retried on the next sync
+	return pushErr
+}
+
+// runPushes runs every queued push, running at most jobs pushes at once, and
+// prints the results in the order the pushes were queued. Pushes to the same
+// remote document are uploaded in a single batch if the secret engine supports
+// it, or otherwise run one after another so they don't race each other
+func (project *Project) runPushes(pushes []pendingPush, jobs int) error {
+	if project.dryRun || len(pushes) == 0 {
+		return nil
+	}
+
+	util.Log.Info("Pushing queued secrets")
+
+	groupIndexes := make(map[string]int)
+	groups := [][]int{}
+
+	for idx, push := range pushes {
+		location := "secret:" + push.secret.Describe()
+
+		if batchable, ok := push.fetchedSecret.(types.BatchUploadable); ok && batchable.BatchKey() != "" {
+			location = "batch:" + batchable.BatchKey()
+		}
+
+		groupIdx, ok := groupIndexes[location]
+		if !ok {
+			groupIdx = len(groups)
+			groupIndexes[location] = groupIdx
+			groups = append(groups, []int{})
+		}
+
+		groups[groupIdx] = append(groups[groupIdx], idx)
+	}
+
+	fileStates := make([]LockedFile, len(pushes))
+	errs := make([]error, len(pushes))
+
+	for idx, push := range pushes {
+		fileStates[idx] = project.currentState.Files[push.secret.File]
+	}
+
+	forEachParallel(len(groups), jobs, func(groupIdx int) error {
+		group := groups[groupIdx]
+
+		if len(group) > 1 {
+			if _, ok := pushes[group[0]].fetchedSecret.(types.BatchUploadable); ok {
+				err := pushBatch(pushes, fileStates, group)
+
+				for _, idx := range group {
+					errs[idx] = err
+				}
+
+				return nil
+			}
+		}
+
+		for _, idx := range group {
+			errs[idx] = project.pushSecret(pushes[idx].fetchedSecret, &fileStates[idx])
+		}
+
+		return nil
+	})
+
+	failed := 0
+
+	for idx, push := range pushes {
+		relativeFilename, err := project.relativeFilename(push.secret.File)
+		if err != nil {
+			return err
+		}
+
+		if errs[idx] != nil {
+			util.Log.Errorf("failed to push '%s': %s", relativeFilename, errs[idx].Error())
+			project.events[push.event].Action = ActionFailed
+			project.events[push.event].Error = errs[idx].Error()
+			failed++
+
+			// The local file changed but the remote didn't, so the new local
+			// hash can't be saved with the old remote version
+			if prevState, ok := project.lastState.Files[push.secret.File]; ok {
+				// Dynamic secrets are never pushed, so any lease is stale
+				prevState.Lease = nil
+				project.currentState.Files[push.secret.File] = prevState
+			} else {
+				delete(project.currentState.Files, push.secret.File)
+			}
+
+			continue
+		}
+
+		project.currentState.Files[push.secret.File] = fileStates[idx]
+		project.events[push.event].NewVersion = fileStates[idx].RemoteVersion
+		util.Log.Infof("    pushed '%s'", relativeFilename)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to push %d secret(s)", failed)
+	}
+
 	return nil
 }
 
@@ -457,24 +740,34 @@ func (project *Project) pullSecret(
 	secret SecretConfig,
 	fetchedSecret types.FetchedSecret,
 	fileState *LockedFile,
+) error {
+	return project.writeSecretFile(secret, fetchedSecret.Value(), fetchedSecret.Format(), fileState)
+}
+
+func (project *Project) writeSecretFile(
+	secret SecretConfig,
+	value interface{},
+	format int,
+	fileState *LockedFile,
 ) error {
 	correctedFilename := filepath.Join(project.path, secret.File)
 
-	hash, err := hashValue(fetchedSecret.Value())
+	hash, err := hashValue(value)
 	if err != nil {
 		return err
 	}
 
-	formattedData, err := util.FormatData(
-		fetchedSecret.Value(),
-		fetchedSecret.Format(),
-	)
+	formattedData, err := util.FormatData(value, format)
 	if err != nil {
 		return err
 	}
 
 	fileState.LocalHash = hash
-	fileState.LocalFormat = util.FormatToName(fetchedSecret.Format())
+	fileState.LocalFormat = util.FormatToName(format)
+
+	if project.dryRun {
+		return nil
+	}
 
 	err = os.MkdirAll(filepath.Dir(correctedFilename), 0777)
 	if err != nil {
@@ -497,6 +790,10 @@ func (project *Project) pushSecret(
 	fetchedSecret types.FetchedSecret,
 	fileState *LockedFile,
 ) error {
+	if project.dryRun {
+		return nil
+	}
+
 	newVersion, err := fetchedSecret.UploadNew(fileState.data)
 	if err != nil {
 		return err
@@ -507,6 +804,92 @@ func (project *Project) pushSecret(
 	return nil
 }
 
+// pushBatch uploads every push in a group of pushes to the same remote document
+// in a single batch
+func pushBatch(pushes []pendingPush, fileStates []LockedFile, group []int) error {
+	batch := make([]types.BatchUpload, len(group))
+
+	for i, idx := range group {
+		batch[i] = types.BatchUpload{
+			Secret: pushes[idx].fetchedSecret.(types.BatchUploadable),
+			Value:  fileStates[idx].data,
+		}
+	}
+
+	newVersion, err := batch[0].Secret.UploadBatch(batch)
+	if err != nil {
+		return err
+	}
+
+	for _, idx := range group {
+		fileStates[idx].RemoteVersion = newVersion
+	}
+
+	return nil
+}
+
+func (project *Project) removeFile(filename string) error {
+	if project.dryRun {
+		return nil
+	}
+
+	return os.Remove(filename)
+}
+
+// isInteractive returns true if the user can be asked what to do. Nobody is
+// asked anything in dry-run mode since nothing would be done anyway
+func (project *Project) isInteractive() bool {
+	return vars.IsTTY && !project.dryRun
+}
+
+// printResult prints the result of an action on a secret file, or the action
+// that would have been done in dry-run mode
+func (project *Project) printResult(result string, dryRunAction string) {
+	if project.dryRun {
+		util.Log.Info("    would " + dryRunAction)
+	} else {
+		util.Log.Info("    " + result)
+	}
+}
+
+func splitDynamicSecrets(secrets []SecretConfig) ([]SecretConfig, []SecretConfig) {
+	staticSecrets := []SecretConfig{}
+	dynamicSecrets := []SecretConfig{}
+
+	for _, secret := range secrets {
+		if secret.IsDynamic() {
+			dynamicSecrets = append(dynamicSecrets, secret)
+		} else {
+			staticSecrets = append(staticSecrets, secret)
+		}
+	}
+
+	return staticSecrets, dynamicSecrets
+}
+
+func cliQuestionPushPullMerge() (bool, bool, bool) {
+	for {
+		answer := util.CliQuestion("Push (u), pull (d), merge (m), or skip (n)?")
+
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "u", "push":
+			return true, false, false
+		case "d", "pull":
+			return false, true, false
+		case "m", "merge":
+			if util.HasMergeTool() {
+				return false, false, true
+			}
+
+			fmt.Println("Set the " + util.MergeToolEnvVar + " environment variable to a merge tool command to merge, i.e. 'meld \"$LOCAL\" \"$MERGED\" \"$REMOTE\"'")
+		case "n", "skip":
+			return false, false, false
+		default:
+			fmt.Println("Please enter one of 'u', 'd', 'm', 'n', 'push', 'pull', 'merge', or 'skip'")
+		}
+	}
+}
+
 func cliQuestionPushPull() (bool, bool) {
 	for {
 		answer := util.CliQuestion("Push (u), pull (d), or skip (n)?")
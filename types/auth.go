@@ -3,4 +3,5 @@ package types
 // RootAuth holds auth configurations for every secrets engine
 type RootAuth struct {
 	Vault *map[string]VaultAuth `json:"vault"`
+	AWS   *map[string]AWSAuth   `json:"aws,omitempty"`
 }
@@ -0,0 +1,8 @@
+package types
+
+// AWSAuth holds static credentials for an AWS profile
+type AWSAuth struct {
+	AccessKeyID     string `json:"accessKeyID"`
+	SecretAccessKey string `json:"secretAccessKey"`
+	SessionToken    string `json:"sessionToken,omitempty"`
+}
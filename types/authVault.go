@@ -1,11 +1,18 @@
 package types
 
-// VaultAuth holds any valid, implemented Vault authentication method
+// VaultAuth holds any valid, implemented Vault authentication method, as well
+// as the Vault Enterprise namespace to log in to and the TLS settings for the
+// Vault instance
 type VaultAuth struct {
-	Userpass *VaultAuthUserpass `json:"userpass,omitempty"`
-	AppRole  *VaultAuthAppRole  `json:"appRole,omitempty"`
-	OIDC     *VaultAuthOIDC     `json:"oidc,omitempty"`
-	Token    *string            `json:"token,omitempty"`
+	Namespace  string               `json:"namespace,omitempty"`
+	TLS        *VaultAuthTLS        `json:"tls,omitempty"`
+	Userpass   *VaultAuthUserpass   `json:"userpass,omitempty"`
+	AppRole    *VaultAuthAppRole    `json:"appRole,omitempty"`
+	OIDC       *VaultAuthOIDC       `json:"oidc,omitempty"`
+	Kubernetes *VaultAuthKubernetes `json:"kubernetes,omitempty"`
+	JWT        *VaultAuthJWT        `json:"jwt,omitempty"`
+	Cert       *VaultAuthCert       `json:"cert,omitempty"`
+	Token      *string              `json:"token,omitempty"`
 }
 
 // VaultAuthUserpass holds a username and password for userpass authentication
@@ -24,3 +31,39 @@ type VaultAuthAppRole struct {
 type VaultAuthOIDC struct {
 	Mount string `json:"mount"`
 }
+
+// VaultAuthKubernetes holds a role, a path to a service account JWT, and a
+// mount path for Kubernetes auth
+type VaultAuthKubernetes struct {
+	Role    string `json:"role"`
+	JWTPath string `json:"jwtPath,omitempty"`
+	Mount   string `json:"mount,omitempty"`
+}
+
+// VaultAuthJWT holds a role, where to read a JWT from, and a mount path for JWT
+// auth. The JWT is read from a file or from an environment variable, like the ID
+// tokens CI/CD pipelines provide
+type VaultAuthJWT struct {
+	Role    string `json:"role"`
+	JWTFile string `json:"jwtFile,omitempty"`
+	JWTEnv  string `json:"jwtEnv,omitempty"`
+	Mount   string `json:"mount,omitempty"`
+}
+
+// VaultAuthTLS holds the TLS settings for connecting to a Vault instance, like
+// a CA bundle for self-signed certificates or a client certificate for cert
+// auth
+type VaultAuthTLS struct {
+	CAFile             string `json:"caFile,omitempty"`
+	ClientCert         string `json:"clientCert,omitempty"`
+	ClientKey          string `json:"clientKey,omitempty"`
+	ServerName         string `json:"serverName,omitempty"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty"`
+}
+
+// VaultAuthCert holds a role name and a mount path for TLS certificate auth,
+// which logs in with the client certificate from the TLS settings
+type VaultAuthCert struct {
+	Name  string `json:"name,omitempty"`
+	Mount string `json:"mount,omitempty"`
+}
@@ -10,3 +10,55 @@ type FetchedSecret interface {
 
 	UploadNew(value interface{}) (interface{}, error)
 }
+
+// Lease describes the lifetime of a dynamic secret issued by a remote server.
+// Times are Unix timestamps, and an Expires of 0 means the secret never
+// expires
+type Lease struct {
+	ID         string `yaml:"id,omitempty"`
+	Expires    int64  `yaml:"expires,omitempty"`
+	RenewAfter int64  `yaml:"renewAfter,omitempty"`
+}
+
+// LeasedSecret is implemented by fetched secrets that may be dynamic secrets,
+// which are issued fresh on every fetch and can't be uploaded. Lease returns
+// nil if the secret is not a dynamic secret
+type LeasedSecret interface {
+	FetchedSecret
+
+	Lease() *Lease
+}
+
+// BatchUpload is a new value for a secret that's uploaded as part of a batch
+type BatchUpload struct {
+	Secret BatchUploadable
+	Value  interface{}
+}
+
+// BatchUploadable is implemented by fetched secrets that may share a remote
+// document with other secrets, so that new values for all of them can be
+// uploaded together in a single write
+type BatchUploadable interface {
+	FetchedSecret
+
+	// BatchKey identifies the remote document this secret is stored in.
+	// Secrets with the same batch key can be uploaded in the same batch, and
+	// an empty batch key means this secret can't be batched
+	BatchKey() string
+
+	// UploadBatch modifies the remote document and replaces the values or
+	// sub-values of every secret in the batch, and returns the new version of
+	// the document
+	UploadBatch(batch []BatchUpload) (interface{}, error)
+}
+
+// VersionedSecret is implemented by fetched secrets whose remote repository
+// keeps older versions, which can be used as the base of a three-way merge
+type VersionedSecret interface {
+	FetchedSecret
+
+	// FetchVersion fetches the value or sub-value of this secret at an older
+	// version, as returned by Version. The returned bool is false if that
+	// version is not available or has no value for this secret
+	FetchVersion(version interface{}) (interface{}, bool, error)
+}
@@ -1,6 +1,13 @@
 package util
 
 import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
 	"github.com/madwire-media/secrets-cli/types"
 	"github.com/madwire-media/secrets-cli/vars"
 )
@@ -16,9 +23,25 @@ func MergeAuth(base *types.RootAuth, overlay *types.RootAuth) {
 			}
 		}
 	}
+
+	if overlay.AWS != nil {
+		if base.AWS == nil {
+			base.AWS = overlay.AWS
+		} else {
+			for key, value := range *overlay.AWS {
+				(*base.AWS)[key] = value
+			}
+		}
+	}
 }
 
-// LoadUserAuth loads the default user auth config
+// savedAuthRefs are the keyring references in the saved user auth config, so
+// entries that aren't referenced anymore can be deleted on the next save
+var savedAuthRefs = make(map[string]struct{})
+
+// LoadUserAuth loads the default user auth config. Credentials referenced from
+// the keyring are only read once they're used, see LoadVaultAuthCredentials
+// and LoadAWSAuthCredentials
 func LoadUserAuth() error {
 	var auth types.RootAuth
 
@@ -27,14 +50,345 @@ func LoadUserAuth() error {
 		return err
 	}
 
+	hasPlainText := false
+
+	err = mapAuthCredentials(&auth, func(key string, value string) (string, error) {
+		if IsCredentialRef(value) {
+			savedAuthRefs[value] = struct{}{}
+		} else if value != "" {
+			hasPlainText = true
+		}
+
+		return value, nil
+	})
+	if err != nil {
+		return err
+	}
+
 	MergeAuth(&vars.UserAuth, &auth)
 
 	vars.UserAuthLoaded = true
 
+	// Move credentials saved by older versions into the keyring, as long as
+	// that doesn't need a password from the user
+	if hasPlainText && KeyringAvailable() {
+		Log.Debugf("moving saved credentials into the keyring")
+
+		return SaveUserAuth()
+	}
+
 	return nil
 }
 
-// SaveUserAuth saves the default user auth config
+// LoadVaultAuthCredentials returns a copy of a Vault auth config with the
+// credentials it references read from the keyring. A credential that can't be
+// read is treated like it was never saved, so its login method is left out
+// and the user gets to log in again
+func LoadVaultAuthCredentials(host string, vaultAuth types.VaultAuth) types.VaultAuth {
+	if vaultAuth.Userpass != nil {
+		userpass := *vaultAuth.Userpass
+		vaultAuth.Userpass = nil
+
+		if password, ok := loadAuthCredential("Vault instance at '"+host+"'", userpass.Password); ok {
+			userpass.Password = password
+			vaultAuth.Userpass = &userpass
+		}
+	}
+
+	if vaultAuth.AppRole != nil {
+		appRole := *vaultAuth.AppRole
+		vaultAuth.AppRole = nil
+
+		if secretID, ok := loadAuthCredential("Vault instance at '"+host+"'", appRole.SecretID); ok {
+			appRole.SecretID = secretID
+			vaultAuth.AppRole = &appRole
+		}
+	}
+
+	if vaultAuth.Token != nil {
+		ref := *vaultAuth.Token
+		vaultAuth.Token = nil
+
+		if token, ok := loadAuthCredential("Vault instance at '"+host+"'", ref); ok {
+			vaultAuth.Token = &token
+		}
+	}
+
+	return vaultAuth
+}
+
+// LoadAWSAuthCredentials returns a copy of an AWS auth config with the
+// credentials it references read from the keyring. The returned bool is false
+// if they can't be read, in which case the profile should be treated like it
+// has no auth config
+func LoadAWSAuthCredentials(profile string, awsAuth types.AWSAuth) (types.AWSAuth, bool) {
+	var ok bool
+
+	awsAuth.SecretAccessKey, ok = loadAuthCredential("AWS profile '"+profile+"'", awsAuth.SecretAccessKey)
+	if !ok {
+		return awsAuth, false
+	}
+
+	awsAuth.SessionToken, ok = loadAuthCredential("AWS profile '"+profile+"'", awsAuth.SessionToken)
+
+	return awsAuth, ok
+}
+
+func loadAuthCredential(name string, value string) (string, bool) {
+	credential, err := LoadCredential(value)
+	if err != nil {
+		Log.Warnf("ignoring saved credentials for %s: %s", name, err)
+		return "", false
+	}
+
+	return credential, true
+}
+
+// SaveUserAuth saves the default user auth config, with its credentials stored
+// in the keyring and only referenced from the config file
 func SaveUserAuth() error {
-	return SaveConfig("auth", &vars.UserAuth)
+	auth := copyAuth(&vars.UserAuth)
+	refs := make(map[string]struct{})
+
+	err := mapAuthCredentials(&auth, func(key string, value string) (string, error) {
+		ref, err := StoreCredential(key, value)
+		if IsCredentialRef(ref) {
+			refs[ref] = struct{}{}
+		}
+
+		return ref, err
+	})
+	if err != nil {
+		return err
+	}
+
+	err = SaveConfig("auth", &auth)
+	if err != nil {
+		return err
+	}
+
+	for ref := range savedAuthRefs {
+		if _, ok := refs[ref]; !ok {
+			err = DeleteCredential(ref)
+			if err != nil {
+				Log.Warnf("%s", err)
+			}
+		}
+	}
+
+	savedAuthRefs = refs
+
+	return nil
+}
+
+// copyAuth copies an auth config deep enough that its credentials can be
+// replaced without changing the original
+func copyAuth(auth *types.RootAuth) types.RootAuth {
+	var authCopy types.RootAuth
+
+	if auth.Vault != nil {
+		vault := make(map[string]types.VaultAuth)
+
+		for host, vaultAuth := range *auth.Vault {
+			if vaultAuth.Userpass != nil {
+				userpass := *vaultAuth.Userpass
+				vaultAuth.Userpass = &userpass
+			}
+
+			if vaultAuth.AppRole != nil {
+				appRole := *vaultAuth.AppRole
+				vaultAuth.AppRole = &appRole
+			}
+
+			if vaultAuth.Token != nil {
+				token := *vaultAuth.Token
+				vaultAuth.Token = &token
+			}
+
+			vault[host] = vaultAuth
+		}
+
+		authCopy.Vault = &vault
+	}
+
+	if auth.AWS != nil {
+		aws := make(map[string]types.AWSAuth)
+
+		for profile, awsAuth := range *auth.AWS {
+			aws[profile] = awsAuth
+		}
+
+		authCopy.AWS = &aws
+	}
+
+	return authCopy
+}
+
+// mapAuthCredentials replaces every credential in an auth config with the
+// result of a function, which gets a unique keyring key for each credential
+func mapAuthCredentials(auth *types.RootAuth, mapFunc func(key string, value string) (string, error)) error {
+	var err error
+
+	if auth.Vault != nil {
+		for host, vaultAuth := range *auth.Vault {
+			prefix := "auth/vault/" + host + "/"
+
+			if vaultAuth.Userpass != nil {
+				vaultAuth.Userpass.Password, err = mapFunc(prefix+"userpass/"+vaultAuth.Userpass.Username, vaultAuth.Userpass.Password)
+				if err != nil {
+					return err
+				}
+			}
+
+			if vaultAuth.AppRole != nil {
+				vaultAuth.AppRole.SecretID, err = mapFunc(prefix+"appRole/"+vaultAuth.AppRole.RoleID, vaultAuth.AppRole.SecretID)
+				if err != nil {
+					return err
+				}
+			}
+
+			if vaultAuth.Token != nil {
+				*vaultAuth.Token, err = mapFunc(prefix+"token", *vaultAuth.Token)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if auth.AWS != nil {
+		for profile, awsAuth := range *auth.AWS {
+			prefix := "auth/aws/" + profile + "/"
+
+			awsAuth.SecretAccessKey, err = mapFunc(prefix+"secretAccessKey", awsAuth.SecretAccessKey)
+			if err != nil {
+				return err
+			}
+
+			awsAuth.SessionToken, err = mapFunc(prefix+"sessionToken", awsAuth.SessionToken)
+			if err != nil {
+				return err
+			}
+
+			(*auth.AWS)[profile] = awsAuth
+		}
+	}
+
+	return nil
+}
+
+// The environment variables and token file the Vault CLI uses
+const (
+	VaultAddrEnvVar      = "VAULT_ADDR"
+	VaultTokenEnvVar     = "VAULT_TOKEN"
+	VaultNamespaceEnvVar = "VAULT_NAMESPACE"
+	VaultCACertEnvVar    = "VAULT_CACERT"
+	vaultTokenFileName   = ".vault-token"
+)
+
+// vaultAddrHost gets the host of the Vault instance in VAULT_ADDR, or an empty
+// string if it isn't set
+func vaultAddrHost() (string, error) {
+	addr := os.Getenv(VaultAddrEnvVar)
+	if addr == "" {
+		return "", nil
+	}
+
+	parsedURL, err := url.Parse(addr)
+	if err != nil || parsedURL.Host == "" {
+		return "", fmt.Errorf("invalid %s '%s', it should look like https://vault.example.com", VaultAddrEnvVar, addr)
+	}
+
+	return parsedURL.Host, nil
+}
+
+// GetVaultTokenFileAuth gets an auth config with the token the Vault CLI saves
+// in ~/.vault-token, for the Vault instance in VAULT_ADDR. It's meant to be the
+// lowest auth layer, so any other auth config for the same host replaces it
+func GetVaultTokenFileAuth() (types.RootAuth, error) {
+	vault := make(map[string]types.VaultAuth)
+	auth := types.RootAuth{Vault: &vault}
+
+	host, err := vaultAddrHost()
+	if err != nil || host == "" {
+		return auth, err
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return auth, err
+	}
+
+	text, err := ioutil.ReadFile(filepath.Join(home, vaultTokenFileName))
+	if os.IsNotExist(err) {
+		return auth, nil
+	} else if err != nil {
+		return auth, err
+	}
+
+	token := strings.TrimSpace(string(text))
+	if token != "" {
+		Log.Debugf("found token in ~/%s for Vault instance at '%s'", vaultTokenFileName, host)
+
+		vault[host] = types.VaultAuth{
+			Token: &token,
+		}
+	}
+
+	return auth, nil
+}
+
+// GetEnvAuth gets an auth config from the VAULT_TOKEN, VAULT_NAMESPACE, and
+// VAULT_CACERT environment variables, for the Vault instance in VAULT_ADDR.
+// Settings that aren't in the environment are kept from the current auth
+// config for the same host, so merging it only overrides the ones that are
+func GetEnvAuth(current *types.RootAuth) (types.RootAuth, error) {
+	vault := make(map[string]types.VaultAuth)
+	auth := types.RootAuth{Vault: &vault}
+
+	host, err := vaultAddrHost()
+	if err != nil || host == "" {
+		return auth, err
+	}
+
+	token := os.Getenv(VaultTokenEnvVar)
+	namespace := os.Getenv(VaultNamespaceEnvVar)
+	caCert := os.Getenv(VaultCACertEnvVar)
+
+	if token == "" && namespace == "" && caCert == "" {
+		return auth, nil
+	}
+
+	var vaultAuth types.VaultAuth
+	if current.Vault != nil {
+		vaultAuth = (*current.Vault)[host]
+	}
+
+	if token != "" {
+		Log.Debugf("using token from %s for Vault instance at '%s'", VaultTokenEnvVar, host)
+
+		vaultAuth = types.VaultAuth{
+			Namespace: vaultAuth.Namespace,
+			TLS:       vaultAuth.TLS,
+			Token:     &token,
+		}
+	}
+
+	if namespace != "" {
+		vaultAuth.Namespace = namespace
+	}
+
+	if caCert != "" {
+		var tlsSettings types.VaultAuthTLS
+		if vaultAuth.TLS != nil {
+			tlsSettings = *vaultAuth.TLS
+		}
+
+		tlsSettings.CAFile = caCert
+		vaultAuth.TLS = &tlsSettings
+	}
+
+	vault[host] = vaultAuth
+
+	return auth, nil
 }
@@ -5,12 +5,18 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"golang.org/x/term"
 )
 
+// PromptMutex serializes interactive prompts while secrets are being processed
+// concurrently. It must be held for a whole interaction, like a question and
+// all of its follow-up questions, and never while waiting on another lock
+var PromptMutex sync.Mutex
+
 // CliQuestionYesNo prints a question prompt and allows either yes or no answers
 // to be entered, returning "y" or "yes" as true and "n" or "no" as false
 func CliQuestionYesNo(question string) bool {
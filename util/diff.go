@@ -0,0 +1,307 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	// DiffRemoved marks a diff line that only exists in the old value
+	DiffRemoved = '-'
+
+	// DiffAdded marks a diff line that only exists in the new value
+	DiffAdded = '+'
+
+	// DiffChanged marks a diff line for a value that exists in both the old
+	// and new values but is different
+	DiffChanged = '~'
+
+	// DiffContext marks a diff line that is the same in both values
+	DiffContext = ' '
+
+	maskedValue = "***"
+
+	// diffContextLines is the number of unchanged lines shown around changes
+	// in a text diff
+	diffContextLines = 2
+)
+
+var identifierRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// DiffLine is a single line of a diff
+type DiffLine struct {
+	Kind byte
+	Text string
+}
+
+// DiffData does a structural diff between two JSON-like values, comparing maps
+// key by key and arrays index by index. A nil value is treated as missing.
+// Unless reveal is true, every value in the diff is masked so that only the
+// paths of changes are shown
+func DiffData(oldValue interface{}, newValue interface{}, reveal bool) []DiffLine {
+	lines := []DiffLine{}
+
+	diffDataAt(&lines, "", oldValue, newValue, reveal)
+
+	return lines
+}
+
+func diffDataAt(lines *[]DiffLine, path string, oldValue interface{}, newValue interface{}, reveal bool) {
+	if oldValue == nil && newValue == nil {
+		return
+	} else if oldValue == nil {
+		*lines = append(*lines, DiffLine{DiffAdded, displayPath(path) + ": " + displayValue(newValue, reveal)})
+		return
+	} else if newValue == nil {
+		*lines = append(*lines, DiffLine{DiffRemoved, displayPath(path) + ": " + displayValue(oldValue, reveal)})
+		return
+	}
+
+	switch oldV := oldValue.(type) {
+	case map[string]interface{}:
+		if newV, ok := newValue.(map[string]interface{}); ok {
+			keys := make([]string, 0, len(oldV)+len(newV))
+
+			for key := range oldV {
+				keys = append(keys, key)
+			}
+
+			for key := range newV {
+				if _, exists := oldV[key]; !exists {
+					keys = append(keys, key)
+				}
+			}
+
+			sort.Strings(keys)
+
+			for _, key := range keys {
+				diffDataAt(lines, path+displayKey(key), oldV[key], newV[key], reveal)
+			}
+
+			return
+		}
+
+	case []interface{}:
+		if newV, ok := newValue.([]interface{}); ok {
+			length := len(oldV)
+			if len(newV) > length {
+				length = len(newV)
+			}
+
+			for i := 0; i < length; i++ {
+				var oldItem, newItem interface{}
+
+				if i < len(oldV) {
+					oldItem = oldV[i]
+				}
+
+				if i < len(newV) {
+					newItem = newV[i]
+				}
+
+				diffDataAt(lines, fmt.Sprintf("%s[%d]", path, i), oldItem, newItem, reveal)
+			}
+
+			return
+		}
+	}
+
+	// Compare leaf values (or values of different types) by their JSON
+	// encoding, so that i.e. YAML ints and JSON floats compare equal
+	if encodeValue(oldValue) == encodeValue(newValue) {
+		return
+	}
+
+	if reveal {
+		*lines = append(*lines, DiffLine{DiffChanged, displayPath(path) + ": " + displayValue(oldValue, true) + " -> " + displayValue(newValue, true)})
+	} else {
+		*lines = append(*lines, DiffLine{DiffChanged, displayPath(path) + ": changed"})
+	}
+}
+
+// DiffText does a line by line diff between two strings, showing a few lines
+// of context around every change. Unless reveal is true, the contents of every
+// line are masked so that only the line numbers of changes are shown
+func DiffText(oldText string, newText string, reveal bool) []DiffLine {
+	oldLines := splitLines(oldText)
+	newLines := splitLines(newText)
+
+	// Find the longest common subsequence of lines with dynamic programming,
+	// where common[i][j] is the LCS length of oldLines[i:] and newLines[j:]
+	common := make([][]int, len(oldLines)+1)
+	for i := range common {
+		common[i] = make([]int, len(newLines)+1)
+	}
+
+	for i := len(oldLines) - 1; i >= 0; i-- {
+		for j := len(newLines) - 1; j >= 0; j-- {
+			if oldLines[i] == newLines[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else if common[i+1][j] >= common[i][j+1] {
+				common[i][j] = common[i+1][j]
+			} else {
+				common[i][j] = common[i][j+1]
+			}
+		}
+	}
+
+	type textLine struct {
+		kind   byte
+		number int
+		text   string
+	}
+
+	all := []textLine{}
+	i, j := 0, 0
+
+	for i < len(oldLines) || j < len(newLines) {
+		if i < len(oldLines) && j < len(newLines) && oldLines[i] == newLines[j] {
+			all = append(all, textLine{DiffContext, j + 1, newLines[j]})
+			i++
+			j++
+		} else if i < len(oldLines) && (j == len(newLines) || common[i+1][j] >= common[i][j+1]) {
+			all = append(all, textLine{DiffRemoved, i + 1, oldLines[i]})
+			i++
+		} else {
+			all = append(all, textLine{DiffAdded, j + 1, newLines[j]})
+			j++
+		}
+	}
+
+	// Only keep context lines close to a change
+	keep := make([]bool, len(all))
+
+	for idx, line := range all {
+		if line.kind == DiffContext {
+			continue
+		}
+
+		for k := idx - diffContextLines; k <= idx+diffContextLines; k++ {
+			if k >= 0 && k < len(all) {
+				keep[k] = true
+			}
+		}
+	}
+
+	lines := []DiffLine{}
+	skipped := false
+
+	for idx, line := range all {
+		if !keep[idx] {
+			skipped = true
+			continue
+		}
+
+		if skipped && len(lines) > 0 {
+			lines = append(lines, DiffLine{DiffContext, "..."})
+		}
+
+		skipped = false
+
+		text := line.text
+		if !reveal {
+			text = maskedValue
+		}
+
+		lines = append(lines, DiffLine{line.kind, fmt.Sprintf("%4d | %s", line.number, text)})
+	}
+
+	return lines
+}
+
+// FormatDiff renders diff lines as text, optionally colored with ANSI escape
+// codes
+func FormatDiff(lines []DiffLine, color bool) string {
+	var builder strings.Builder
+
+	for _, line := range lines {
+		text := string(line.Kind) + " " + line.Text
+
+		if color {
+			switch line.Kind {
+			case DiffRemoved:
+				text = "\x1b[31m" + text + "\x1b[0m"
+			case DiffAdded:
+				text = "\x1b[32m" + text + "\x1b[0m"
+			case DiffChanged:
+				text = "\x1b[33m" + text + "\x1b[0m"
+			}
+		}
+
+		builder.WriteString(text)
+		builder.WriteString("\n")
+	}
+
+	return builder.String()
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return []string{}
+	}
+
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+func displayKey(key string) string {
+	if identifierRegexp.MatchString(key) {
+		return "." + key
+	}
+
+	return "[" + encodeValue(key) + "]"
+}
+
+func displayPath(path string) string {
+	if path == "" {
+		return "."
+	}
+
+	return path
+}
+
+func displayValue(value interface{}, reveal bool) string {
+	if !reveal {
+		value = maskValue(value)
+	}
+
+	return encodeValue(value)
+}
+
+// maskValue replaces every leaf of a JSON-like value with a mask, keeping the
+// structure of maps and arrays
+func maskValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		masked := make(map[string]interface{}, len(v))
+
+		for key, child := range v {
+			masked[key] = maskValue(child)
+		}
+
+		return masked
+
+	case []interface{}:
+		masked := make([]interface{}, len(v))
+
+		for i, child := range v {
+			masked[i] = maskValue(child)
+		}
+
+		return masked
+
+	default:
+		return maskedValue
+	}
+}
+
+func encodeValue(value interface{}) string {
+	asJSON, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+
+	return string(asJSON)
+}
@@ -0,0 +1,181 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// KeyringPrefix marks a config value as a reference to a keyring entry instead
+// of the value itself
+const KeyringPrefix = "keyring:"
+
+// KeyringEnvVar is the environment variable that picks the keyring backend,
+// either "secret-service" or "file". By default the Secret Service is used when
+// it's available, and the encrypted file otherwise
+const KeyringEnvVar = "SECRETS_KEYRING"
+
+// ErrCredentialNotFound is returned when a keyring entry doesn't exist
+var ErrCredentialNotFound = errors.New("credential not found in keyring")
+
+// errKeyringNeedsPrompt is returned when a keyring can't be opened without
+// asking the user for a password
+var errKeyringNeedsPrompt = errors.New("keyring needs a password to be opened")
+
+// CredentialStore stores credentials outside of the plain JSON config files
+type CredentialStore interface {
+	Name() string
+	Get(key string) (string, error)
+	Set(key string, value string) error
+	Delete(key string) error
+}
+
+var (
+	keyringMutex   sync.Mutex
+	keyringOpened  bool
+	keyring        CredentialStore
+	keyringErr     error
+	keyringWarning sync.Once
+)
+
+// OpenKeyring returns the user's credential store, opening it on first use
+func OpenKeyring() (CredentialStore, error) {
+	keyringMutex.Lock()
+	defer keyringMutex.Unlock()
+
+	if !keyringOpened {
+		keyring, keyringErr = openKeyring(true)
+		keyringOpened = true
+
+		if keyringErr == nil {
+			Log.Debugf("using %s to store credentials", keyring.Name())
+		}
+	}
+
+	return keyring, keyringErr
+}
+
+func openKeyring(prompt bool) (CredentialStore, error) {
+	backend := os.Getenv(KeyringEnvVar)
+
+	switch backend {
+	case "", "secret-service":
+		store, err := newSecretServiceStore()
+		if err == nil {
+			return store, nil
+		} else if backend != "" {
+			return nil, err
+		}
+
+		Log.Debugf("Secret Service is not available: %s", err)
+
+	case "file":
+
+	default:
+		return nil, fmt.Errorf("unknown keyring backend '%s' in %s", backend, KeyringEnvVar)
+	}
+
+	return newFileStore(prompt)
+}
+
+// KeyringAvailable checks if a keyring is open or can be opened without asking
+// the user for a password, so plain text credentials can be moved into it
+// without getting in the way of commands that don't need any credentials
+func KeyringAvailable() bool {
+	keyringMutex.Lock()
+	defer keyringMutex.Unlock()
+
+	if !keyringOpened {
+		store, err := openKeyring(false)
+		if err == errKeyringNeedsPrompt {
+			// It can still be opened with a prompt once it's needed
+			return false
+		}
+
+		keyring, keyringErr = store, err
+		keyringOpened = true
+
+		if keyringErr == nil {
+			Log.Debugf("using %s to store credentials", keyring.Name())
+		}
+	}
+
+	return keyringErr == nil
+}
+
+// IsCredentialRef checks if a config value is a reference to a keyring entry
+func IsCredentialRef(value string) bool {
+	return strings.HasPrefix(value, KeyringPrefix)
+}
+
+// StoreCredential saves a credential in the keyring, returning a reference to
+// save in its place. If there is no keyring available then a warning is
+// printed and the credential itself is returned, so it's still saved like it
+// used to be
+func StoreCredential(key string, value string) (string, error) {
+	if value == "" || IsCredentialRef(value) {
+		return value, nil
+	}
+
+	store, err := OpenKeyring()
+	if err != nil {
+		keyringWarning.Do(func() {
+			Log.Warnf("no keyring available, saving credentials as plain text: %s", err)
+		})
+
+		return value, nil
+	}
+
+	err = store.Set(key, value)
+	if err != nil {
+		return "", fmt.Errorf("could not save '%s' in %s: %w", key, store.Name(), err)
+	}
+
+	return KeyringPrefix + key, nil
+}
+
+// LoadCredential returns the credential a config value references, or the value
+// itself if it isn't a keyring reference
+func LoadCredential(value string) (string, error) {
+	if !IsCredentialRef(value) {
+		return value, nil
+	}
+
+	key := strings.TrimPrefix(value, KeyringPrefix)
+
+	store, err := OpenKeyring()
+	if err != nil {
+		return "", fmt.Errorf("could not read '%s' from keyring: %w", key, err)
+	}
+
+	credential, err := store.Get(key)
+	if err != nil {
+		return "", fmt.Errorf("could not read '%s' from %s: %w", key, store.Name(), err)
+	}
+
+	return credential, nil
+}
+
+// DeleteCredential deletes the keyring entry a config value references, if it
+// is a keyring reference
+func DeleteCredential(value string) error {
+	if !IsCredentialRef(value) {
+		return nil
+	}
+
+	key := strings.TrimPrefix(value, KeyringPrefix)
+
+	store, err := OpenKeyring()
+	if err != nil {
+		return err
+	}
+
+	err = store.Delete(key)
+	if err != nil && err != ErrCredentialNotFound {
+		return fmt.Errorf("could not delete '%s' from %s: %w", key, store.Name(), err)
+	}
+
+	return nil
+}
@@ -0,0 +1,240 @@
+package util
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/madwire-media/secrets-cli/vars"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+)
+
+// KeyringPasswordEnvVar is the environment variable holding the password for
+// the encrypted keyring file, so it doesn't have to be entered every time
+const KeyringPasswordEnvVar = "SECRETS_KEYRING_PASSWORD"
+
+const (
+	keyringFileName = "keyring.json"
+
+	// The check value is encrypted with the key so a wrong password can be
+	// detected before anything is written with it
+	keyringCheckValue = "mw-secrets"
+
+	scryptN       = 32768
+	scryptR       = 8
+	scryptP       = 1
+	keySize       = 32
+	nonceSize     = 24
+	saltSize      = 32
+	minSealedSize = nonceSize + secretbox.Overhead
+)
+
+// fileStore is a credential store in a single file, where every credential is
+// encrypted with NaCl secretbox using a key derived from a password with scrypt
+type fileStore struct {
+	// mutex guards data and the file itself, since credentials are loaded and
+	// saved from the goroutines processing secrets
+	mutex    sync.Mutex
+	filename string
+	key      [keySize]byte
+	data     keyringFileData
+}
+
+type keyringFileData struct {
+	Salt    []byte            `json:"salt"`
+	Check   []byte            `json:"check"`
+	Entries map[string][]byte `json:"entries"`
+}
+
+func newFileStore(prompt bool) (CredentialStore, error) {
+	dir, err := GetConfigDir()
+	if err != nil {
+		return nil, err
+	}
+
+	store := &fileStore{
+		filename: dir + keyringFileName,
+	}
+
+	text, err := ioutil.ReadFile(store.filename)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	isNew := err != nil
+
+	if !isNew {
+		err = json.Unmarshal(text, &store.data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	password, err := keyringPassword(isNew, prompt)
+	if err != nil {
+		return nil, err
+	}
+
+	if isNew {
+		store.data.Salt = make([]byte, saltSize)
+
+		_, err = io.ReadFull(rand.Reader, store.data.Salt)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	key, err := scrypt.Key([]byte(password), store.data.Salt, scryptN, scryptR, scryptP, keySize)
+	if err != nil {
+		return nil, err
+	}
+
+	copy(store.key[:], key)
+
+	if isNew {
+		store.data.Check, err = store.seal(keyringCheckValue)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		check, err := store.open(store.data.Check)
+		if err != nil || check != keyringCheckValue {
+			return nil, errors.New("wrong keyring password")
+		}
+	}
+
+	if store.data.Entries == nil {
+		store.data.Entries = make(map[string][]byte)
+	}
+
+	return store, nil
+}
+
+func keyringPassword(isNew bool, prompt bool) (string, error) {
+	if password := os.Getenv(KeyringPasswordEnvVar); password != "" {
+		return password, nil
+	}
+
+	if !prompt {
+		return "", errKeyringNeedsPrompt
+	}
+
+	if !vars.IsTTY {
+		return "", errors.New("no Secret Service available, and " + KeyringPasswordEnvVar + " is not set for the encrypted keyring file")
+	}
+
+	if !isNew {
+		return CliQuestionHidden("Keyring password")
+	}
+
+	Log.Info("Credentials are saved in an encrypted file, please choose a password for it")
+
+	for {
+		password, err := CliQuestionHidden("New keyring password")
+		if err != nil {
+			return "", err
+		}
+
+		if password == "" {
+			Log.Info("Password cannot be empty")
+			continue
+		}
+
+		confirmation, err := CliQuestionHidden("Confirm keyring password")
+		if err != nil {
+			return "", err
+		}
+
+		if password == confirmation {
+			return password, nil
+		}
+
+		Log.Info("Passwords don't match, please try again")
+	}
+}
+
+func (store *fileStore) Name() string {
+	return "encrypted keyring file"
+}
+
+func (store *fileStore) Get(key string) (string, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	sealed, ok := store.data.Entries[key]
+	if !ok {
+		return "", ErrCredentialNotFound
+	}
+
+	return store.open(sealed)
+}
+
+func (store *fileStore) Set(key string, value string) error {
+	sealed, err := store.seal(value)
+	if err != nil {
+		return err
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.data.Entries[key] = sealed
+
+	return store.save()
+}
+
+func (store *fileStore) Delete(key string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if _, ok := store.data.Entries[key]; !ok {
+		return ErrCredentialNotFound
+	}
+
+	delete(store.data.Entries, key)
+
+	return store.save()
+}
+
+func (store *fileStore) seal(value string) ([]byte, error) {
+	var nonce [nonceSize]byte
+
+	_, err := io.ReadFull(rand.Reader, nonce[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return secretbox.Seal(nonce[:], []byte(value), &nonce, &store.key), nil
+}
+
+func (store *fileStore) open(sealed []byte) (string, error) {
+	var nonce [nonceSize]byte
+
+	if len(sealed) < minSealedSize {
+		return "", errors.New("keyring entry is corrupt")
+	}
+
+	copy(nonce[:], sealed[:nonceSize])
+
+	value, ok := secretbox.Open(nil, sealed[nonceSize:], &nonce, &store.key)
+	if !ok {
+		return "", errors.New("keyring entry could not be decrypted")
+	}
+
+	return string(value), nil
+}
+
+// save writes the store to its file, the mutex must be held
+func (store *fileStore) save() error {
+	text, err := json.Marshal(&store.data)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(store.filename, text, 0600)
+}
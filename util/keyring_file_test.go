@@ -0,0 +1,82 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func newTestFileStore(t *testing.T) CredentialStore {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(KeyringPasswordEnvVar, "test password")
+
+	err := os.MkdirAll(filepath.Join(home, ".config", "mw-secrets"), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := newFileStore(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return store
+}
+
+func TestFileStoreConcurrentAccess(t *testing.T) {
+	store := newTestFileStore(t)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			key := fmt.Sprintf("key-%d", i)
+			value := fmt.Sprintf("value-%d", i)
+
+			for j := 0; j < 20; j++ {
+				err := store.Set(key, value)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+
+				got, err := store.Get(key)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+
+				if got != value {
+					t.Errorf("expected %q, got %q", value, got)
+					return
+				}
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	// Every credential has to survive in the file, not just in memory
+	reopened, err := newFileStore(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 8; i++ {
+		got, err := reopened.Get(fmt.Sprintf("key-%d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected := fmt.Sprintf("value-%d", i); got != expected {
+			t.Errorf("expected %q, got %q", expected, got)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	secretServiceName       = "org.freedesktop.secrets"
+	secretServicePath       = "/org/freedesktop/secrets"
+	secretServiceInterface  = "org.freedesktop.Secret.Service"
+	secretCollectionIface   = "org.freedesktop.Secret.Collection"
+	secretItemInterface     = "org.freedesktop.Secret.Item"
+	secretPromptInterface   = "org.freedesktop.Secret.Prompt"
+	secretServiceAttribute  = "service"
+	secretServiceAttrValue  = "mw-secrets"
+	secretKeyAttribute      = "key"
+	secretDefaultCollection = "default"
+)
+
+// secretServiceStore is a credential store in the default collection of the
+// freedesktop.org Secret Service, like GNOME Keyring or KWallet, over D-Bus
+type secretServiceStore struct {
+	conn       *dbus.Conn
+	session    dbus.ObjectPath
+	collection dbus.ObjectPath
+}
+
+// secretServiceSecret is the Secret struct from the Secret Service API
+type secretServiceSecret struct {
+	Session     dbus.ObjectPath
+	Parameters  []byte
+	Value       []byte
+	ContentType string
+}
+
+func newSecretServiceStore() (CredentialStore, error) {
+	conn, err := dbus.SessionBusPrivateNoAutoStartup()
+	if err != nil {
+		return nil, err
+	}
+
+	store := &secretServiceStore{
+		conn: conn,
+	}
+
+	err = store.connect()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return store, nil
+}
+
+func (store *secretServiceStore) connect() error {
+	err := store.conn.Auth(nil)
+	if err != nil {
+		return err
+	}
+
+	err = store.conn.Hello()
+	if err != nil {
+		return err
+	}
+
+	service := store.conn.Object(secretServiceName, secretServicePath)
+
+	// The secrets are already protected by the D-Bus connection, so they're
+	// transferred as plain text like most Secret Service clients do
+	var output dbus.Variant
+	err = service.Call(secretServiceInterface+".OpenSession", 0, "plain", dbus.MakeVariant("")).Store(&output, &store.session)
+	if err != nil {
+		return err
+	}
+
+	err = service.Call(secretServiceInterface+".ReadAlias", 0, secretDefaultCollection).Store(&store.collection)
+	if err != nil {
+		return err
+	}
+
+	if store.collection == "/" {
+		return errors.New("Secret Service has no default collection")
+	}
+
+	return nil
+}
+
+func (store *secretServiceStore) Name() string {
+	return "Secret Service"
+}
+
+func (store *secretServiceStore) Get(key string) (string, error) {
+	item, err := store.findItem(key)
+	if err != nil {
+		return "", err
+	}
+
+	err = store.unlock(item)
+	if err != nil {
+		return "", err
+	}
+
+	var secret secretServiceSecret
+
+	err = store.conn.Object(secretServiceName, item).Call(secretItemInterface+".GetSecret", 0, store.session).Store(&secret)
+	if err != nil {
+		return "", err
+	}
+
+	return string(secret.Value), nil
+}
+
+func (store *secretServiceStore) Set(key string, value string) error {
+	err := store.unlock(store.collection)
+	if err != nil {
+		return err
+	}
+
+	properties := map[string]dbus.Variant{
+		secretItemInterface + ".Label":      dbus.MakeVariant(fmt.Sprintf("Secrets CLI credential '%s'", key)),
+		secretItemInterface + ".Attributes": dbus.MakeVariant(store.attributes(key)),
+	}
+
+	secret := secretServiceSecret{
+		Session:     store.session,
+		Value:       []byte(value),
+		ContentType: "text/plain",
+	}
+
+	var item, prompt dbus.ObjectPath
+
+	err = store.conn.Object(secretServiceName, store.collection).Call(secretCollectionIface+".CreateItem", 0, properties, secret, true).Store(&item, &prompt)
+	if err != nil {
+		return err
+	}
+
+	_, err = store.prompt(prompt)
+	return err
+}
+
+func (store *secretServiceStore) Delete(key string) error {
+	item, err := store.findItem(key)
+	if err != nil {
+		return err
+	}
+
+	var prompt dbus.ObjectPath
+
+	err = store.conn.Object(secretServiceName, item).Call(secretItemInterface+".Delete", 0).Store(&prompt)
+	if err != nil {
+		return err
+	}
+
+	_, err = store.prompt(prompt)
+	return err
+}
+
+func (store *secretServiceStore) attributes(key string) map[string]string {
+	return map[string]string{
+		secretServiceAttribute: secretServiceAttrValue,
+		secretKeyAttribute:     key,
+	}
+}
+
+func (store *secretServiceStore) findItem(key string) (dbus.ObjectPath, error) {
+	var items []dbus.ObjectPath
+
+	err := store.conn.Object(secretServiceName, store.collection).Call(secretCollectionIface+".SearchItems", 0, store.attributes(key)).Store(&items)
+	if err != nil {
+		return "", err
+	}
+
+	if len(items) == 0 {
+		return "", ErrCredentialNotFound
+	}
+
+	return items[0], nil
+}
+
+// unlock unlocks a collection or item, which may ask the user for their login
+// password in a dialog from the Secret Service
+func (store *secretServiceStore) unlock(object dbus.ObjectPath) error {
+	var unlocked []dbus.ObjectPath
+	var prompt dbus.ObjectPath
+
+	err := store.conn.Object(secretServiceName, secretServicePath).Call(secretServiceInterface+".Unlock", 0, []dbus.ObjectPath{object}).Store(&unlocked, &prompt)
+	if err != nil {
+		return err
+	}
+
+	if len(unlocked) > 0 {
+		return nil
+	}
+
+	dismissed, err := store.prompt(prompt)
+	if err != nil {
+		return err
+	} else if dismissed {
+		return errors.New("Secret Service was not unlocked")
+	}
+
+	return nil
+}
+
+// prompt shows a Secret Service prompt and waits for it to complete, returning
+// true if the user dismissed it. The "/" path means no prompt is needed
+func (store *secretServiceStore) prompt(prompt dbus.ObjectPath) (bool, error) {
+	if prompt == "/" {
+		return false, nil
+	}
+
+	err := store.conn.AddMatchSignal(
+		dbus.WithMatchObjectPath(prompt),
+		dbus.WithMatchInterface(secretPromptInterface),
+		dbus.WithMatchMember("Completed"),
+	)
+	if err != nil {
+		return false, err
+	}
+
+	signals := make(chan *dbus.Signal, 1)
+	store.conn.Signal(signals)
+	defer store.conn.RemoveSignal(signals)
+
+	err = store.conn.Object(secretServiceName, prompt).Call(secretPromptInterface+".Prompt", 0, "").Err
+	if err != nil {
+		return false, err
+	}
+
+	for signal := range signals {
+		if signal.Path != prompt || signal.Name != secretPromptInterface+".Completed" {
+			continue
+		}
+
+		if len(signal.Body) > 0 {
+			if dismissed, ok := signal.Body[0].(bool); ok {
+				return dismissed, nil
+			}
+		}
+
+		return false, nil
+	}
+
+	return false, errors.New("D-Bus connection closed while waiting for Secret Service prompt")
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package util
+
+import "errors"
+
+func newSecretServiceStore() (CredentialStore, error) {
+	return nil, errors.New("Secret Service is only supported on Linux")
+}
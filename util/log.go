@@ -0,0 +1,177 @@
+package util
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Log levels, from least to most verbose
+const (
+	LevelQuiet = iota
+	LevelInfo
+	LevelDebug
+)
+
+// Log is the global logger, which is set up by the -v and -q CLI flags in
+// cmd/root.go
+var Log = &Logger{
+	Level: LevelInfo,
+}
+
+// Logger prints messages at or below its level. Info messages go to stdout
+// like any other command output, while errors, warnings, and debug messages go
+// to stderr. Errors and warnings are always printed. Prompts aren't logged
+// since they always need to be shown
+type Logger struct {
+	Level int
+	mutex sync.Mutex
+}
+
+// Enabled returns true if messages at the given level are printed
+func (logger *Logger) Enabled(level int) bool {
+	return logger.Level >= level
+}
+
+// Debugf prints a debug message, which is only shown with the -v flag
+func (logger *Logger) Debugf(format string, args ...interface{}) {
+	if logger.Enabled(LevelDebug) {
+		logger.print(os.Stderr, "debug: "+fmt.Sprintf(format, args...))
+	}
+}
+
+// Info prints an info message like fmt.Println, unless the -q flag is enabled
+func (logger *Logger) Info(args ...interface{}) {
+	if logger.Enabled(LevelInfo) {
+		logger.print(os.Stdout, strings.TrimSuffix(fmt.Sprintln(args...), "\n"))
+	}
+}
+
+// Infof prints an info message like fmt.Printf, unless the -q flag is enabled.
+// A trailing newline is added if there isn't one
+func (logger *Logger) Infof(format string, args ...interface{}) {
+	if logger.Enabled(LevelInfo) {
+		logger.print(os.Stdout, fmt.Sprintf(format, args...))
+	}
+}
+
+// Warnf prints a warning
+func (logger *Logger) Warnf(format string, args ...interface{}) {
+	logger.print(os.Stderr, "warning: "+fmt.Sprintf(format, args...))
+}
+
+// Errorf prints an error
+func (logger *Logger) Errorf(format string, args ...interface{}) {
+	logger.print(os.Stderr, "error: "+fmt.Sprintf(format, args...))
+}
+
+func (logger *Logger) print(writer io.Writer, message string) {
+	logger.mutex.Lock()
+	defer logger.mutex.Unlock()
+
+	if !strings.HasSuffix(message, "\n") {
+		message += "\n"
+	}
+
+	fmt.Fprint(writer, message)
+}
+
+// TraceHTTP wraps an HTTP transport so every request is logged at debug level,
+// or returns it as-is if debug logging is disabled. A nil transport means
+// http.DefaultTransport
+func TraceHTTP(transport http.RoundTripper) http.RoundTripper {
+	if !Log.Enabled(LevelDebug) {
+		return transport
+	}
+
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	return &tracingTransport{transport}
+}
+
+// tracingTransport logs HTTP requests and responses without their bodies,
+// since those can hold secrets, and with credentials in headers redacted
+type tracingTransport struct {
+	base http.RoundTripper
+}
+
+func (transport *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	Log.Debugf("HTTP %s %s%s", req.Method, redactURL(req.URL), formatHeaders(req.Header))
+
+	start := time.Now()
+
+	resp, err := transport.base.RoundTrip(req)
+	if err != nil {
+		Log.Debugf("HTTP %s %s failed after %s: %s", req.Method, redactURL(req.URL), time.Since(start).Round(time.Millisecond), err)
+		return nil, err
+	}
+
+	Log.Debugf("HTTP %s %s -> %s in %s%s", req.Method, redactURL(req.URL), resp.Status, time.Since(start).Round(time.Millisecond), formatHeaders(resp.Header))
+
+	return resp, nil
+}
+
+// isSensitiveName returns true if a header or query param name looks like it
+// holds credentials
+func isSensitiveName(name string) bool {
+	name = strings.ToLower(name)
+
+	for _, word := range []string{"token", "auth", "cookie", "secret", "password", "signature", "credential", "code"} {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func formatHeaders(header http.Header) string {
+	var builder strings.Builder
+
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, value := range header[name] {
+			if isSensitiveName(name) {
+				value = "<redacted>"
+			}
+
+			builder.WriteString("\n    " + name + ": " + value)
+		}
+	}
+
+	return builder.String()
+}
+
+func redactURL(parsedURL *url.URL) string {
+	rawURL := parsedURL.Redacted()
+
+	parts := strings.SplitN(rawURL, "?", 2)
+	if len(parts) < 2 {
+		return rawURL
+	}
+
+	params := strings.Split(parts[1], "&")
+
+	for idx, param := range params {
+		pair := strings.SplitN(param, "=", 2)
+		if len(pair) == 2 && isSensitiveName(pair[0]) {
+			params[idx] = pair[0] + "=<redacted>"
+		}
+	}
+
+	return parts[0] + "?" + strings.Join(params, "&")
+}
@@ -0,0 +1,119 @@
+package util
+
+import (
+	"sort"
+)
+
+// MergeConflict is a value that was changed differently on both sides of a
+// three-way merge. A value that was deleted on one side is nil, with the
+// matching Exists flag set to false
+type MergeConflict struct {
+	Path         string
+	Local        interface{}
+	Remote       interface{}
+	LocalExists  bool
+	RemoteExists bool
+}
+
+// ConflictResolver decides how to resolve a merge conflict, returning true to
+// keep the local value or false to keep the remote value
+type ConflictResolver func(conflict MergeConflict) (bool, error)
+
+// MergeData does a three-way merge of two JSON-like values that were both
+// changed from the same base value. Maps are merged key by key, so that changes
+// to different keys on each side are combined, while any other values are
+// merged as a whole. Values changed differently on both sides are passed to
+// resolve
+func MergeData(base interface{}, local interface{}, remote interface{}, resolve ConflictResolver) (interface{}, error) {
+	merged, _, err := mergeDataAt("", base, local, remote, true, true, true, resolve)
+	return merged, err
+}
+
+func mergeDataAt(
+	path string,
+	base interface{},
+	local interface{},
+	remote interface{},
+	baseExists bool,
+	localExists bool,
+	remoteExists bool,
+	resolve ConflictResolver,
+) (interface{}, bool, error) {
+	localMatchesRemote := localExists == remoteExists && (!localExists || encodeValue(local) == encodeValue(remote))
+	localMatchesBase := localExists == baseExists && (!localExists || encodeValue(local) == encodeValue(base))
+	remoteMatchesBase := remoteExists == baseExists && (!remoteExists || encodeValue(remote) == encodeValue(base))
+
+	if localMatchesRemote || remoteMatchesBase {
+		// Both sides made the same change, or only the local side changed
+		return local, localExists, nil
+	} else if localMatchesBase {
+		// Only the remote side changed
+		return remote, remoteExists, nil
+	}
+
+	localMap, localIsMap := local.(map[string]interface{})
+	remoteMap, remoteIsMap := remote.(map[string]interface{})
+	baseMap, baseIsMap := base.(map[string]interface{})
+
+	if localIsMap && remoteIsMap && (baseIsMap || !baseExists) {
+		keys := make(map[string]struct{})
+
+		for _, m := range []map[string]interface{}{baseMap, localMap, remoteMap} {
+			for key := range m {
+				keys[key] = struct{}{}
+			}
+		}
+
+		sortedKeys := make([]string, 0, len(keys))
+		for key := range keys {
+			sortedKeys = append(sortedKeys, key)
+		}
+
+		sort.Strings(sortedKeys)
+
+		merged := make(map[string]interface{})
+
+		for _, key := range sortedKeys {
+			baseValue, baseHasKey := baseMap[key]
+			localValue, localHasKey := localMap[key]
+			remoteValue, remoteHasKey := remoteMap[key]
+
+			value, exists, err := mergeDataAt(
+				path+displayKey(key),
+				baseValue,
+				localValue,
+				remoteValue,
+				baseHasKey,
+				localHasKey,
+				remoteHasKey,
+				resolve,
+			)
+			if err != nil {
+				return nil, false, err
+			}
+
+			if exists {
+				merged[key] = value
+			}
+		}
+
+		return merged, true, nil
+	}
+
+	keepLocal, err := resolve(MergeConflict{
+		Path:         displayPath(path),
+		Local:        local,
+		Remote:       remote,
+		LocalExists:  localExists,
+		RemoteExists: remoteExists,
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	if keepLocal {
+		return local, localExists, nil
+	}
+
+	return remote, remoteExists, nil
+}
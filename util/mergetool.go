@@ -0,0 +1,56 @@
+package util
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+// MergeToolEnvVar is the environment variable holding the merge tool command
+const MergeToolEnvVar = "SECRETS_MERGETOOL"
+
+// MergeToolFiles are the files passed to a merge tool, like in git's mergetool.
+// Base is empty if there is no common version to merge from, and Merged is
+// where the merge tool should write the result
+type MergeToolFiles struct {
+	Local  string
+	Remote string
+	Base   string
+	Merged string
+}
+
+// HasMergeTool returns true if a merge tool command is configured
+func HasMergeTool() bool {
+	return os.Getenv(MergeToolEnvVar) != ""
+}
+
+// RunMergeTool runs the configured merge tool command in a shell, with the
+// $LOCAL, $REMOTE, $BASE, and $MERGED environment variables set to the merge
+// files, i.e. SECRETS_MERGETOOL='meld "$LOCAL" "$MERGED" "$REMOTE"'
+func RunMergeTool(files MergeToolFiles) error {
+	command := os.Getenv(MergeToolEnvVar)
+	if command == "" {
+		return errors.New(MergeToolEnvVar + " is not set")
+	}
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+
+	cmd.Env = append(
+		os.Environ(),
+		"LOCAL="+files.Local,
+		"REMOTE="+files.Remote,
+		"BASE="+files.Base,
+		"MERGED="+files.Merged,
+	)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	return cmd.Run()
+}
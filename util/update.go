@@ -71,7 +71,7 @@ func TryAutoUpdateSelf() error {
 	if update != nil && vars.BuildVersion != "dev" {
 		err = update.apply(true)
 		if err != nil {
-			fmt.Println("Error performing self-update:", err)
+			Log.Errorf("failed to perform self-update: %s", err)
 		}
 	}
 
@@ -95,10 +95,10 @@ func TryManualUpdate() error {
 	if update != nil {
 		err = update.apply(false)
 		if err != nil {
-			fmt.Println("Error performing self-update:", err)
+			Log.Errorf("failed to perform self-update: %s", err)
 		}
 	} else {
-		fmt.Println("No updates found")
+		Log.Info("No updates found")
 	}
 
 	return nil
@@ -171,7 +171,7 @@ func (updater *autoUpdater) Init() error {
 			otherState = "enable"
 		}
 
-		fmt.Println("You can " + otherState + " this later by running 'secrets config autoupdate'")
+		Log.Info("You can " + otherState + " this later by running 'secrets config autoupdate'")
 
 		shouldSave = true
 	}
@@ -209,7 +209,7 @@ func (updater *autoUpdater) checkForUpdate(force bool) (*updatedRelease, error)
 		}
 	}
 
-	fmt.Println("Checking for updates...")
+	Log.Info("Checking for updates...")
 
 	updater.config.LastUpdateTime = &now
 	err := updater.save()
@@ -264,7 +264,7 @@ func (updater *autoUpdater) checkForUpdate(force bool) (*updatedRelease, error)
 }
 
 func (update *updatedRelease) apply(restart bool) error {
-	fmt.Println("Updating to", update.version)
+	Log.Info("Updating to", update.version)
 
 	thisExe, err := osext.Executable()
 	if err != nil {
@@ -346,7 +346,7 @@ func (update *updatedRelease) apply(restart bool) error {
 	}
 
 	if restart {
-		fmt.Println("Complete, restarting command...")
+		Log.Info("Complete, restarting command...")
 
 		env := os.Environ()
 		args := os.Args
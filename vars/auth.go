@@ -19,8 +19,10 @@ var (
 
 func makeRootAuth() types.RootAuth {
 	vault := make(map[string]types.VaultAuth)
+	aws := make(map[string]types.AWSAuth)
 
 	return types.RootAuth{
 		Vault: &vault,
+		AWS:   &aws,
 	}
 }
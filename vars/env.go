@@ -10,11 +10,25 @@ var (
 	// Workdir is the working directory this program was started with
 	Workdir string
 
+	// ProjectDir is the directory containing the secrets.yaml of the opened
+	// project, or an empty string if no project has been opened
+	ProjectDir string
+
 	// IsCICD is true when the --cicd flag is enabled or the CICD environment
 	// variable is non-null. The environment variable check is here in this
 	// file, but the CLI flag definition is in cmd/root.go
 	IsCICD bool
 
+	// AllowHTTP is true when the --allow-http flag is enabled, which allows
+	// connecting to Vault over plain HTTP for local development. The CLI flag
+	// definition is in cmd/root.go
+	AllowHTTP bool
+
+	// IsDryRun is true when the sync command's --dry-run flag is enabled, so
+	// nothing on disk or remotely should be changed. The CLI flag definition
+	// is in cmd/sync.go
+	IsDryRun bool
+
 	// IsTTY is true when the program is running in a TTY and theoretically is
 	// being piloted by a user. If IsTTY is false then there should not be any
 	// CLI prompts